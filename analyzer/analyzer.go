@@ -5,14 +5,12 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"regexp"
 	"runtime/debug"
 	"strings"
 	database "vodka/database"
-	mysqld "vodka/database/mysql"
-	"vodka/plugin"
 	page "vodka/plugin/page"
 	runner "vodka/runner"
+	"vodka/util"
 	"vodka/xml"
 )
 
@@ -27,6 +25,7 @@ type Function struct {
 	Id     string                                                                  //方法名
 	Type   string                                                                  //方法类型
 	Mapper string                                                                  //所属的mapper
+	Plan   *Plan                                                                   //编译后的执行计划
 	Func   func(resultWrappers []interface{}, params map[string]interface{}) error //方法体
 }
 
@@ -54,6 +53,20 @@ func NewAnalyzer(xmlContent string) *Analyzer {
 }
 
 func CallFunction(fn *Function, params map[string]interface{}, resultWrappers []interface{}) error {
+	prepareParams(params)
+	return fn.Func(resultWrappers, params)
+}
+
+// 只渲染sql而不执行，参数的处理和CallFunction一致
+func (fn *Function) Render(params map[string]interface{}) (string, []interface{}, error) {
+	if fn.Plan == nil {
+		return "", nil, fmt.Errorf("方法 %s 编译失败", fn.Id)
+	}
+	prepareParams(params)
+	return fn.Plan.Render(params)
+}
+
+func prepareParams(params map[string]interface{}) {
 	// 任何时候，如果params中只有一个参数，且为map或者结构体指针的情况下，将其展开放入params中
 	for k, v := range params {
 		// 如果k以...开头，则默认展开
@@ -62,7 +75,7 @@ func CallFunction(fn *Function, params map[string]interface{}, resultWrappers []
 			params[strings.TrimPrefix(k, "...")] = v
 			delete(params, k)
 			// 展开
-			extractObject(v, params)
+			expandObject(v, params)
 			// for mk, mv := range v.(map[string]interface{}) {
 			// 	params[mk] = mv
 			// }
@@ -73,7 +86,7 @@ func CallFunction(fn *Function, params map[string]interface{}, resultWrappers []
 		for _, v := range params {
 			// params[k] = reflect.ValueOf(v).Interface()
 			// 如果是map
-			extractObject(v, params)
+			expandObject(v, params)
 			// if reflect.TypeOf(v).Kind() == reflect.Map {
 			// 	for mk, mv := range v.(map[string]interface{}) {
 			// 		params[mk] = mv
@@ -86,8 +99,6 @@ func CallFunction(fn *Function, params map[string]interface{}, resultWrappers []
 			break
 		}
 	}
-
-	return fn.Func(resultWrappers, params)
 }
 
 func (t *Analyzer) Call(id string, params map[string]interface{}, resultWrappers []interface{}) error {
@@ -122,17 +133,23 @@ func (t *Analyzer) Parse() error {
 	}
 	// 设置命名空间
 	t.Namespace = namespace
+	var errs []error
 	for _, node := range root.Children {
 		// node的attributes里必须有id属性，否则不处理
 		id, ok := node.Attrs["id"]
 		if !ok {
 			continue
 		}
-		t.Functions[id] = generateFunction(namespace, node, root)
+		function, err := generateFunction(namespace, node, root)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		t.Functions[id] = function
 	}
 
 	t.inited = true
-	return nil
+	// 编译失败的语句在解析时就返回错误，不等到调用时才发现
+	return errors.Join(errs...)
 }
 
 // 编译多个自定义sql
@@ -145,11 +162,7 @@ func ParseXml(namespace, xmlContent string) ([]*Function, error) {
 	if err != nil {
 		return nil, err
 	}
-	functions := make([]*Function, 0)
-	for _, node := range root.Children {
-		functions = append(functions, generateFunction(namespace, node, root))
-	}
-	return functions, nil
+	return generateFunctions(namespace, root)
 }
 
 // 用于将来的自动装配通用sql语句
@@ -168,11 +181,7 @@ func ParseMultiSql(namespace string, sqls []string) ([]*Function, error) {
 	if err != nil {
 		return nil, err
 	}
-	functions := make([]*Function, 0)
-	for _, node := range root.Children {
-		functions = append(functions, generateFunction(namespace, node, root))
-	}
-	return functions, nil
+	return generateFunctions(namespace, root)
 }
 
 // 编译单个sql
@@ -187,14 +196,45 @@ func ParseSingleSql(namespace, sql string) (*Function, error) {
 	if err != nil {
 		return nil, err
 	}
-	return generateFunction(namespace, root, root), nil
+	return generateFunction(namespace, root, root)
 
 }
 
 // ---------------------- 以下为私有方法 ----------------------
 
-// 生成对应的方法体
-func generateFunction(mapperName string, node *xml.Node, root *xml.Node) *Function {
+// 生成根节点下所有语句的方法体，返回所有语句的编译错误
+func generateFunctions(namespace string, root *xml.Node) ([]*Function, error) {
+	functions := make([]*Function, 0)
+	var errs []error
+	for _, node := range root.Children {
+		function, err := generateFunction(namespace, node, root)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		functions = append(functions, function)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return functions, nil
+}
+
+// 生成对应的方法体，编译失败时返回错误，调用该方法同样会返回该错误
+// sql片段编译失败时不返回错误，被include时会在引用它的语句中报错
+func generateFunction(mapperName string, node *xml.Node, root *xml.Node) (*Function, error) {
+	// 编译执行计划
+	plan, compileErr := CompilePlan(node, root)
+	statement, err := compileBatchStatement(fmt.Sprintf("【%s】【%s】", mapperName, node.Attrs["id"]), node.Attrs, node.Name)
+	if err != nil && compileErr == nil {
+		compileErr = err
+	}
+	lock, err := compileLock(node.Attrs, node.Name)
+	if err != nil && compileErr == nil {
+		compileErr = err
+	}
+	if compileErr != nil {
+		compileErr = fmt.Errorf("【%s】【%s】 编译失败: %w", mapperName, node.Attrs["id"], compileErr)
+	}
 	funcFunc := func(resultWrappers []interface{}, params map[string]interface{}) (resultErr error) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -202,307 +242,108 @@ func generateFunction(mapperName string, node *xml.Node, root *xml.Node) *Functi
 				resultErr = errors.New("捕获到错误")
 			}
 		}()
-		var builder strings.Builder
-		var invokeParams []interface{}
-		for _, child := range node.Children {
-			HandleNode(&builder, child, params, &invokeParams, root)
+		if compileErr != nil {
+			return compileErr
 		}
-		log.Printf("【%s】【%s】 sql : %s %v", mapperName, node.Attrs["id"], builder.String(), invokeParams)
-		// 插件系统
-		// 构造HOOK CONTEXT
-		// todo: 插件后续再开发
-		// builderPtr := &builder
-		// hookContext := plugin.HookContext{
-		// 	Builder:        &builderPtr,
-		// 	RequestParams:  &invokeParams,
-		// 	ResultWrappers: &resultWrappers,
-		// }
-		// fmt.Print(hookContext)
-		// 如果是查询语句
-		if node.Name == "SELECT" {
-			// hookContext.Fn = func() {
-			// 如果是在分页查询的环境下
-			pg := page.GetPageContext()
-			if pg != nil {
-				// 这里表示已经开启了分页的，但是因为无法获得具体的泛型，没办法转换
-				// 先查询总页数
-				resultErr = page.QueryPage(mysqld.GetDB(), builder.String(), invokeParams, resultWrappers, pg)
-				// total, _ := page.SelectTotal(mysqld.GetDB(), builder.String(), invokeParams)
-				// pg.TotalRows = total
-				//resultErr = database.QueryStruct(mysqld.GetDB(), builder.String(), invokeParams, resultWrappers)
-			} else {
-				resultErr = database.QueryStruct(mysqld.GetDB(), builder.String(), invokeParams, resultWrappers)
+		execute := func() error {
+			if statement.batch {
+				return statement.executeBatch(plan, params, resultWrappers)
 			}
-			// }
-			// 执行插件
-			// plugin.Execute(hookContext)
-		} else if node.Name == "INSERT" || node.Name == "UPDATE" || node.Name == "DELETE" {
-			// 只能执行这三个指令
-			// hookContext.Fn = func() {
-			resultErr = database.ExecuteInt64(mysqld.GetDB(), builder.String(), invokeParams, resultWrappers)
-			// }
+			sql, invokeParams, err := plan.Render(params)
+			if err != nil {
+				return err
+			}
+			if sql, err = lockSql(sql, lock, params); err != nil {
+				return err
+			}
+			log.Printf("【%s】【%s】 sql : %s %v", mapperName, node.Attrs["id"], sql, invokeParams)
+			// 集合过大时拆分执行
+			if node.Name == "INSERT" || node.Name == "UPDATE" || node.Name == "DELETE" {
+				if chunked, err := statement.executeChunked(plan, params, node.Name == "INSERT", len(invokeParams), resultWrappers); chunked || err != nil {
+					return err
+				}
+			}
+			if statement.keys != nil {
+				_, collection, _ := plan.chunkCollection(params, node.Name == "INSERT", statement.collection)
+				affected, lastInsertId, err := statement.keys.execute(sql, invokeParams, params, statement.keys.items(collection))
+				if err != nil {
+					return err
+				}
+				database.SetExecResult(resultWrappers, affected, lastInsertId)
+				return nil
+			}
+			return Execute(node.Name, sql, invokeParams, resultWrappers)
+		}
+		if plan.selectKey != nil {
+			return plan.selectKey.wrap(params, execute)
 		}
-		return resultErr
+		return execute()
 	}
 
-	return &Function{
+	function := &Function{
 		Mapper: mapperName,
 		Id:     node.Attrs["id"],
 		Type:   node.Name,
+		Plan:   plan,
 		Func:   funcFunc,
 	}
-}
-
-// 处理节点
-func HandleNode(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	if node.Type == xml.Text {
-		handleText(builder, node, params, resultParams)
-	} else {
-		switch node.Name {
-		case "IF":
-			handleIfStatement(builder, node, params, resultParams, root)
-		case "FOREACH":
-			handleForeachStatement(builder, node, params, resultParams, root)
-		case "WHERE":
-			handleWhereStatement(builder, node, params, resultParams, root)
-		case "SET":
-			handleSetStatement(builder, node, params, resultParams, root)
-		case "SQL":
-			handleSqlStatement(builder, node, params, resultParams, root)
-		case "INCLUDE":
-			handleIncludeStatement(builder, node, params, resultParams, root)
-		default:
-			// 处理自定义节点
-			handleCustomStatement(builder, node, params, resultParams, root)
-		}
-	}
-}
-
-// 处理if语句
-func handleIfStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	// 获取test属性的值
-	testExpr, ok := node.Attrs["test"]
-	if !ok {
-		panic("if语句缺少test属性")
-	}
-
-	// 解析并计算test表达式
-	result := runner.EvaluateExpression(testExpr, params)
-
-	// 如果表达式结果为true，则处理if语句的子节点
-	if result != false {
-		for _, child := range node.Children {
-			HandleNode(builder, child, params, resultParams, root)
-		}
-	}
-}
-
-// 处理foreach语句
-func handleForeachStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	// 获取目标需要循环的对象，默认为list
-	collectionKey, ok := node.Attrs["collection"]
-	if !ok {
-		collectionKey = "list"
-	}
-	collection, ok := params[collectionKey]
-	if !ok {
-		panic("集合不存在")
-		// return errors.New("集合不存在")
-	}
-	// 必须是slice或者array
-	collectionType := reflect.TypeOf(collection)
-	if collectionType.Kind() != reflect.Slice && collectionType.Kind() != reflect.Array {
-		panic("集合类型错误")
-		// return errors.New("集合类型错误")
-	}
-
-	// 获取映射的key，默认为item
-	mapKey, ok := node.Attrs["item"]
-	if !ok {
-		mapKey = "item"
-	}
-	// 获取分隔符，默认为逗号
-	separator, ok := node.Attrs["separator"]
-	if !ok {
-		separator = ","
-	}
-	// 获取open和close，默认为空即可
-	open, ok := node.Attrs["open"]
-	if !ok {
-		open = ""
-	}
-	close, ok := node.Attrs["close"]
-	if !ok {
-		close = ""
-	}
-	if open != "" {
-		builder.WriteString(open)
-	}
-	// 拼接字符串
-	// 将 collection 转换为数组
-	var childBuilder0 strings.Builder
-	var childBuilder1 strings.Builder
-	collectionValue := reflect.ValueOf(collection)
-	collectionLength := collectionValue.Len()
-	for i := 0; i < collectionLength; i++ {
-		childBuilder0.Reset()
-		params[mapKey] = collectionValue.Index(i).Interface()
-		// 获取map的key
-		for _, child := range node.Children {
-			HandleNode(&childBuilder0, child, params, resultParams, root)
-		}
-		if childBuilder0.Len() > 0 {
-			childBuilder0.WriteString(separator)
-		}
-		childBuilder1.WriteString(childBuilder0.String())
-	}
-	// 去除childbuilder1最后的separator
-	childStr := childBuilder1.String()
-	if len(childStr) > 0 {
-		// 去除childStr最后的separator
-		childStr = strings.TrimSuffix(childStr, separator)
-		builder.WriteString(childStr)
-	}
-	if close != "" {
-		builder.WriteString(close)
+	if node.Name == "SQL" {
+		return function, nil
 	}
+	return function, compileErr
 }
 
-func handleWhereStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-
-	// 移除第一个 "AND" 或 "OR"
-	sqlBuilder := strings.Builder{}
-	isFirstCondition := true
-	for _, child := range node.Children {
-		childBuilder := &strings.Builder{}
-		HandleNode(childBuilder, child, params, resultParams, root)
-
-		childSQL := strings.TrimSpace(childBuilder.String())
-
-		if strings.HasPrefix(strings.ToUpper(childSQL), "AND") || strings.HasPrefix(strings.ToUpper(childSQL), "OR") {
-			if isFirstCondition {
-				childSQL = strings.TrimSpace(childSQL[3:])
-				isFirstCondition = false
-			}
+// 执行已经渲染好的sql，和xml中定义的语句使用相同的执行路径：当前协程的事务、分页插件、预编译语句缓存
+// statementType为SELECT、INSERT、UPDATE、DELETE
+func Execute(statementType string, sql string, args []interface{}, resultWrappers []interface{}) error {
+	// 如果是查询语句
+	if statementType == "SELECT" {
+		// 如果是在分页查询的环境下
+		pg := page.GetPageContext()
+		if pg != nil && page.IsCursor(pg) {
+			// 游标分页
+			return page.QueryCursor(CurrentExecutor(), sql, args, resultWrappers, pg)
+		} else if pg != nil {
+			// 这里表示已经开启了分页的，但是因为无法获得具体的泛型，没办法转换
+			return page.QueryPage(CurrentExecutor(), sql, args, resultWrappers, pg)
 		}
-
-		sqlBuilder.WriteString(childSQL)
-		sqlBuilder.WriteString(" ")
-	}
-	childSql := strings.TrimSpace(sqlBuilder.String())
-	if childSql != "" {
-		builder.WriteString(" where ")
-		builder.WriteString(childSql)
-		builder.WriteByte(' ')
+		return database.QueryStruct(CurrentExecutor(), sql, args, resultWrappers)
+	} else if statementType == "INSERT" || statementType == "UPDATE" || statementType == "DELETE" {
+		// 只能执行这三个指令
+		return database.ExecuteInt64(CurrentExecutor(), sql, args, resultWrappers)
 	}
+	return nil
 }
 
-func handleSetStatement(builder *strings.Builder, node *xml.Node, params map[string]any, resultParams *[]any, root *xml.Node) {
-	builder.WriteString(" set ")
-	var childBuilder strings.Builder
-	// 移除末尾的逗号
-	for _, child := range node.Children {
-		HandleNode(&childBuilder, child, params, resultParams, root)
+// 处理节点
+// 主要供自定义标签处理子节点使用，节点会被即时编译后渲染
+func HandleNode(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
+	compiled, err := compileNode(node, root, nil)
+	if err != nil {
+		panic(err)
 	}
-	childSQL := strings.TrimSpace(childBuilder.String())
-	if strings.HasSuffix(childSQL, ",") {
-		childSQL = childSQL[:len(childSQL)-1]
+	if compiled != nil {
+		compiled.render(builder, params, resultParams)
 	}
-	builder.WriteString(childSQL)
-	builder.WriteString(" ")
 }
 
-func handleSqlStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	for _, child := range node.Children {
-		HandleNode(builder, child, params, resultParams, root)
-	}
-}
+// 被展开的参数，keyProperty没有路径时只写回其中的结构体指针或map
+// 使用结构体指针保存，不会被当作批量执行的集合
+const expandedKey = "_expanded"
 
-func handleIncludeStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	// 获取include的文件名
-	refid, ok := node.Attrs["refid"]
-	if !ok {
-		return
-	}
-	// 查找root中是否有符合id的节点
-	for _, child := range root.Children {
-		if child.Attrs["id"] == refid {
-			// 不能是自身
-			if child == node {
-				continue
-			}
-			// 获取include的文件内容
-			HandleNode(builder, child, params, resultParams, root)
-			break
-		}
-	}
+type expandedObjects struct {
+	objects []interface{}
 }
 
-func handleCustomStatement(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}, root *xml.Node) {
-	handler, ok := plugin.GetTagHandler(node.Name)
+// 展开参数并记录被展开的对象
+func expandObject(v any, params map[string]any) {
+	extractObject(v, params)
+	expanded, ok := params[expandedKey].(*expandedObjects)
 	if !ok {
-		panic(fmt.Sprintf("未找到标签处理器: %s", node.Name))
-	}
-	handler(builder, node, params, resultParams, root)
-}
-
-// 处理文本节点
-func handleText(builder *strings.Builder, node *xml.Node, params map[string]interface{}, resultParams *[]interface{}) {
-	text := node.Text
-	if text == "" {
-		return
-	}
-	// 使用正则表达式匹配 #{abc.xxx} 和 ${abc.xxx} 格式的内容
-	re := regexp.MustCompile(`(#|\$)\{([^}]+)\}`)
-
-	text = re.ReplaceAllStringFunc(text, func(match string) string {
-		if strings.HasPrefix(match, "${") {
-			// 处理 ${} 格式，直接拼接
-			key := strings.Trim(match, "${}")
-			value := runner.GetValue(key, params)
-			return fmt.Sprintf("%v", value)
-		} else {
-			// 处理 #{} 格式，使用参数化查询
-			// 特殊情况，如果key为$AUTO，则自动生成id
-			value := getValueByBlock(match, params)
-			if value == "$AUTO" {
-				return "DEFAULT"
-			}
-			*resultParams = append(*resultParams, value)
-			return "?"
-		}
-	})
-
-	builder.WriteString(text)
-}
-
-// 根据key获取值
-// 处理 #{abc.xxx} 格式的内容
-// todo: 处理 ${abc.xxx} 格式的内容 即不处理内容直接输出
-func getValueByBlock(key string, params map[string]interface{}) any {
-	key = strings.Trim(key, "#{}")
-	// 处理三元表达式的情况
-	if strings.Contains(key, "?") || strings.Contains(key, "(") {
-		value := runner.EvaluateExpression(key, params)
-		return value
-		//return fmt.Sprintf("%v", value)
-	} else {
-		value := runner.GetValue(key, params)
-		return value
-		//return fmt.Sprintf("%v", value)
-	}
-}
-
-func getValueByDollarBlock(key string, params map[string]interface{}) string {
-	key = strings.Trim(key, "${}")
-	// 处理三元表达式
-	if strings.Contains(key, "?") {
-		value := runner.EvaluateExpression(key, params)
-		return fmt.Sprintf("%v", value)
-	} else {
-		value := runner.GetValue(key, params)
-		return fmt.Sprintf("%v", value)
+		expanded = &expandedObjects{}
+		params[expandedKey] = expanded
 	}
+	expanded.objects = append(expanded.objects, v)
 }
 
 func extractObject(v any, params map[string]any) {
@@ -524,13 +365,19 @@ func extractStructFields(structValue reflect.Value, params map[string]interface{
 	for i := 0; i < structValue.NumField(); i++ {
 		field := structType.Field(i)
 		fieldValue := structValue.Field(i)
+		if util.VoIgnored(field.Tag.Get("vo")) {
+			continue
+		}
 
 		// 优先使用vo tag
-		key := field.Tag.Get("vo")
+		key := util.VoName(field.Tag.Get("vo"))
 		if key == "" {
 			key = field.Name
 		}
 
-		params[key] = fieldValue.Interface()
+		params[key] = runner.FieldValue(fieldValue)
+		if encrypted, deterministic := util.VoEncrypt(field.Tag.Get("vo")); encrypted {
+			MarkEncrypted(params, key, deterministic)
+		}
 	}
 }
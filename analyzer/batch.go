@@ -0,0 +1,349 @@
+package analyzer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	database "vodka/database"
+)
+
+// 批量执行的配置
+type BatchOptions struct {
+	MaxRows         int // 每条语句最多包含的集合元素个数，0表示不限制
+	MaxPlaceholders int // 每条语句最多包含的占位符个数，0表示不限制
+}
+
+// 默认不限制元素个数，只在超过MySQL的占位符上限65535时拆分
+var batchOptions = BatchOptions{MaxPlaceholders: 65535}
+
+// 设置全局的拆分配置，应该在初始化时调用
+// 语句上的batchSize属性可以单独覆盖MaxRows
+func SetBatchOptions(options BatchOptions) {
+	batchOptions = options
+}
+
+func GetBatchOptions() BatchOptions {
+	return batchOptions
+}
+
+// 语句上和批量执行有关的属性
+// executor="batch" 表示对collection中的每个元素执行一次语句，语句在事务中只预编译一次
+// batchSize="500" 表示集合超过500个元素时拆分成多条语句执行
+type batchStatement struct {
+	label      string
+	batch      bool
+	collection string
+	item       string
+	maxRows    int
+	keys       *generatedKeys // 插入后写回主键，没有声明keyProperty时为nil
+}
+
+func compileBatchStatement(label string, attrs map[string]string, nodeName string) (*batchStatement, error) {
+	statement := &batchStatement{
+		label:      label,
+		collection: attrs["collection"],
+		item:       attrs["item"],
+		maxRows:    -1,
+	}
+	if statement.item == "" {
+		statement.item = "item"
+	}
+	if size, ok := attrs["batchSize"]; ok {
+		maxRows, err := strconv.Atoi(size)
+		if err != nil || maxRows < 0 {
+			return nil, fmt.Errorf("batchSize必须是非负整数: %s", size)
+		}
+		statement.maxRows = maxRows
+	}
+	keys, err := compileGeneratedKeys(attrs, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	statement.keys = keys
+	switch attrs["executor"] {
+	case "", "simple":
+	case "batch":
+		if nodeName != "INSERT" && nodeName != "UPDATE" && nodeName != "DELETE" {
+			return nil, errors.New("只有insert、update、delete可以使用batch执行器")
+		}
+		statement.batch = true
+	default:
+		return nil, fmt.Errorf("未知的执行器: %s", attrs["executor"])
+	}
+	return statement, nil
+}
+
+// 查找批量执行的集合，未指定collection时使用唯一的切片参数
+func (s *batchStatement) findCollection(params map[string]interface{}) (string, reflect.Value, error) {
+	if s.collection != "" {
+		value := reflect.ValueOf(params[s.collection])
+		if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+			return "", reflect.Value{}, fmt.Errorf("批量执行的集合 %s 不存在或不是切片", s.collection)
+		}
+		return s.collection, value, nil
+	}
+	var key string
+	var collection reflect.Value
+	for k, v := range params {
+		value := reflect.ValueOf(v)
+		if value.Kind() != reflect.Slice || value.Type().Elem().Kind() == reflect.Uint8 {
+			continue
+		}
+		if key != "" {
+			return "", reflect.Value{}, errors.New("存在多个切片参数，请通过collection属性指定批量执行的集合")
+		}
+		key, collection = k, value
+	}
+	if key == "" {
+		return "", reflect.Value{}, errors.New("没有找到批量执行的集合")
+	}
+	return key, collection, nil
+}
+
+// batch执行器，集合中的每个元素单独渲染并执行，元素的字段会被展开
+// 相同的sql在事务中复用同一个预编译语句
+func (s *batchStatement) executeBatch(plan *Plan, params map[string]interface{}, resultWrappers []interface{}) error {
+	key, collection, err := s.findCollection(params)
+	if err != nil {
+		return err
+	}
+	var affected, lastInsertId int64
+	err = Transaction(func() error {
+		return CurrentTx().CacheStmts(func() error {
+			return s.executeEach(plan, params, key, collection, &affected, &lastInsertId)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s batch执行 %d 次，影响 %d 行", s.label, collection.Len(), affected)
+	database.SetExecResult(resultWrappers, affected, lastInsertId)
+	return nil
+}
+
+// 逐个元素渲染并执行语句
+func (s *batchStatement) executeEach(plan *Plan, params map[string]interface{}, key string, collection reflect.Value, affected *int64, lastInsertId *int64) error {
+	for i := 0; i < collection.Len(); i++ {
+		elem := collection.Index(i).Interface()
+		elemParams := make(map[string]interface{}, len(params)+1)
+		for k, v := range params {
+			if k != key && k != expandedKey {
+				elemParams[k] = v
+			}
+		}
+		elemParams[s.item] = elem
+		if elem != nil {
+			expandObject(elem, elemParams)
+		}
+		sql, args, err := plan.Render(elemParams)
+		if err != nil {
+			return err
+		}
+		if err := s.execute(sql, args, elemParams, reflect.Value{}, affected, lastInsertId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 如果语句中foreach的集合过大，拆分成多条语句在同一个事务中执行
+// 返回false表示不需要拆分
+func (s *batchStatement) executeChunked(plan *Plan, params map[string]interface{}, insert bool, argCount int, resultWrappers []interface{}) (bool, error) {
+	maxRows := batchOptions.MaxRows
+	if s.maxRows >= 0 {
+		maxRows = s.maxRows
+	}
+	maxPlaceholders := batchOptions.MaxPlaceholders
+	key, collection, ok := plan.chunkCollection(params, insert, s.collection)
+	if !ok || collection.Len() <= 1 {
+		return false, nil
+	}
+	rows := collection.Len()
+	if (maxRows <= 0 || rows <= maxRows) && (maxPlaceholders <= 0 || argCount <= maxPlaceholders) {
+		return false, nil
+	}
+
+	// 按照平均每个元素的占位符个数估算每批的大小，渲染后仍然超出的再对半拆分
+	size := rows
+	if maxRows > 0 && size > maxRows {
+		size = maxRows
+	}
+	// 语句中没有占位符时（如全部是字面量），只按元素个数拆分
+	if perRow := (argCount + rows - 1) / rows; maxPlaceholders > 0 && perRow > 0 {
+		if estimated := maxPlaceholders / perRow; estimated < size {
+			size = estimated
+		}
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	type chunk struct {
+		sql   string
+		args  []interface{}
+		items reflect.Value
+	}
+	chunks := make([]chunk, 0, (rows+size-1)/size)
+	var split func(items reflect.Value) error
+	split = func(items reflect.Value) error {
+		params[key] = items.Interface()
+		sql, args, err := plan.Render(params)
+		if err != nil {
+			return err
+		}
+		if maxPlaceholders > 0 && len(args) > maxPlaceholders {
+			if items.Len() == 1 {
+				return fmt.Errorf("单个元素的占位符个数 %d 超过了上限 %d", len(args), maxPlaceholders)
+			}
+			half := items.Len() / 2
+			if err := split(items.Slice(0, half)); err != nil {
+				return err
+			}
+			return split(items.Slice(half, items.Len()))
+		}
+		chunks = append(chunks, chunk{sql: sql, args: args, items: items})
+		return nil
+	}
+	original := params[key]
+	defer func() {
+		params[key] = original
+	}()
+	for start := 0; start < rows; start += size {
+		end := start + size
+		if end > rows {
+			end = rows
+		}
+		if err := split(collection.Slice(start, end)); err != nil {
+			return true, err
+		}
+	}
+
+	var affected, lastInsertId int64
+	err := Transaction(func() error {
+		for _, c := range chunks {
+			items := reflect.Value{}
+			if s.keys != nil {
+				items = s.keys.items(c.items)
+			}
+			if err := s.execute(c.sql, c.args, params, items, &affected, &lastInsertId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return true, err
+	}
+	log.Printf("%s 集合 %s 共 %d 个元素，拆分为 %d 条语句执行，影响 %d 行", s.label, key, rows, len(chunks), affected)
+	database.SetExecResult(resultWrappers, affected, lastInsertId)
+	return true, nil
+}
+
+// 执行拆分后的一条语句并累加结果，声明了keyProperty时写回生成的主键
+func (s *batchStatement) execute(sql string, args []interface{}, params map[string]interface{}, items reflect.Value, affected *int64, lastInsertId *int64) error {
+	if s.keys == nil {
+		result, err := database.Execute(CurrentExecutor(), sql, args...)
+		if err != nil {
+			return err
+		}
+		return accumulateResult(result, affected, lastInsertId)
+	}
+	rows, id, err := s.keys.execute(sql, args, params, items)
+	if err != nil {
+		return err
+	}
+	*affected += rows
+	if *lastInsertId == 0 {
+		*lastInsertId = id
+	}
+	return nil
+}
+
+// 累加影响的行数，最后插入的id取第一条语句的
+func accumulateResult(result sql.Result, affected *int64, lastInsertId *int64) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	*affected += rows
+	if *lastInsertId == 0 {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		*lastInsertId = id
+	}
+	return nil
+}
+
+// 查找可以拆分的集合：直接取自参数的切片，且foreach不在where、if等条件中
+// 语句上声明了collection时只拆分该集合，否则只拆分insert语句中紧跟在values之后的foreach
+// where中的in、not in等条件拆分后语义会改变（not in拆分后会匹配所有行），永远不拆分
+func (p *Plan) chunkCollection(params map[string]interface{}, insert bool, name string) (string, reflect.Value, bool) {
+	if name == "" && !insert {
+		return "", reflect.Value{}, false
+	}
+	var key string
+	var collection reflect.Value
+	found := false
+	walkForeach(p.nodes, func(f *foreachPlan, afterValues bool) bool {
+		if len(f.collection) != 1 {
+			return true
+		}
+		if name != "" && f.collection[0] != name {
+			return true
+		}
+		if name == "" && !afterValues {
+			return true
+		}
+		value := reflect.ValueOf(params[f.collection[0]])
+		if value.Kind() != reflect.Slice {
+			return true
+		}
+		key, collection, found = f.collection[0], value, true
+		return false
+	})
+	return key, collection, found
+}
+
+// 遍历语句顶层（包括include的片段）的foreach，afterValues表示foreach紧跟在values之后，fn返回false时停止
+// where、if、set、trim中的foreach是条件或更新的列，不会被遍历
+func walkForeach(nodes []planNode, fn func(f *foreachPlan, afterValues bool) bool) bool {
+	afterValues := false
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *foreachPlan:
+			if !fn(n, afterValues) {
+				return false
+			}
+		case *sqlPlan:
+			if !walkForeach(n.children, fn) {
+				return false
+			}
+		}
+		if !isBlank(node) {
+			afterValues = endsWithValues(node)
+		}
+	}
+	return true
+}
+
+// 节点是否是只有空白的文本
+func isBlank(node planNode) bool {
+	text, ok := node.(*textPlan)
+	return ok && len(text.segments) == 1 && text.segments[0].kind == 0 && strings.TrimSpace(text.segments[0].literal) == ""
+}
+
+// 节点是否是以values结尾的文本
+func endsWithValues(node planNode) bool {
+	text, ok := node.(*textPlan)
+	if !ok || len(text.segments) == 0 {
+		return false
+	}
+	last := text.segments[len(text.segments)-1]
+	return last.kind == 0 && strings.HasSuffix(strings.ToLower(strings.TrimSpace(last.literal)), "values")
+}
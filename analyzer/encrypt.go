@@ -0,0 +1,46 @@
+package analyzer
+
+import (
+	"strings"
+	"vodka/encrypt"
+	"vodka/runner"
+	"vodka/util"
+)
+
+// 参数中需要加密的路径，key为用.连接的路径，value为是否使用确定性加密
+// 结构体展开时记录声明了encrypt的字段，通用Mapper记录map参数中加密的列
+const encryptKey = "_encrypt"
+
+// 标记参数中的路径需要加密，如 EQ_phone、action.phone
+func MarkEncrypted(params map[string]interface{}, path string, deterministic bool) {
+	paths, ok := params[encryptKey].(map[string]bool)
+	if !ok {
+		paths = make(map[string]bool)
+		params[encryptKey] = paths
+	}
+	paths[path] = deterministic
+}
+
+// #{}绑定参数时加密声明了encrypt的字段，先查找标记的路径，再查找路径对应的结构体字段
+func encryptParam(path []string, params map[string]interface{}, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	paths, _ := params[encryptKey].(map[string]bool)
+	deterministic, ok := paths[strings.Join(path, ".")]
+	if !ok {
+		tag, found := runner.PathFieldTag(path, params)
+		if !found {
+			return value
+		}
+		var encrypted bool
+		if encrypted, deterministic = util.VoEncrypt(tag.Get("vo")); !encrypted {
+			return value
+		}
+	}
+	value, err := encrypt.Value(value, deterministic)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
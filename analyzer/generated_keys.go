@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	database "vodka/database"
+)
+
+// insert语句上的keyProperty，插入后把数据库生成的主键写回参数
+// <insert id="InsertDep" keyProperty="id"> ... </insert>
+// 支持RETURNING的方言（postgresql、sqlite）在语句后追加 returning keyColumn，按顺序写回每一行
+// mysql使用LastInsertId，多行插入时为第一行的id，之后主键为零值的元素按auto_increment_increment递增写回
+// 这依赖同一条语句生成的id是连续的，innodb_autoinc_lock_mode为2且有并发插入时可能不成立，此时应该逐条插入
+// 语句中有foreach的切片参数时写回切片中的每个元素，否则写回顶层参数中的结构体指针或map，keyProperty可以是 dep.id 这样的路径
+type generatedKeys struct {
+	keyProperty string
+	keyColumn   string
+}
+
+func compileGeneratedKeys(attrs map[string]string, nodeName string) (*generatedKeys, error) {
+	keyProperty := attrs["keyProperty"]
+	if keyProperty == "" || attrs["useGeneratedKeys"] == "false" {
+		return nil, nil
+	}
+	if nodeName != "INSERT" {
+		return nil, errors.New("只有insert可以使用keyProperty")
+	}
+	keyColumn := attrs["keyColumn"]
+	if keyColumn == "" {
+		keyColumn = keyProperty[strings.LastIndex(keyProperty, ".")+1:]
+	}
+	return &generatedKeys{keyProperty: keyProperty, keyColumn: keyColumn}, nil
+}
+
+// 执行插入语句并写回主键，items为本条语句插入的元素，不是多行插入时为无效的reflect.Value
+func (g *generatedKeys) execute(sql string, args []interface{}, params map[string]interface{}, items reflect.Value) (affected int64, lastInsertId int64, err error) {
+	if database.GetDialect().SupportsReturning() {
+		rows, err := database.QueryMap(CurrentExecutor(), sql+" returning "+g.keyColumn, args...)
+		if err != nil {
+			return 0, 0, err
+		}
+		keys := make([]interface{}, len(rows))
+		for i, row := range rows {
+			for _, value := range row {
+				keys[i] = value
+			}
+		}
+		if len(keys) > 0 {
+			if id, ok := keys[0].(int64); ok {
+				lastInsertId = id
+			}
+		}
+		if items.IsValid() {
+			for i := 0; i < items.Len() && i < len(keys); i++ {
+				if _, _, err := setProperty(items.Index(i).Interface(), g.property(), keys[i]); err != nil {
+					return 0, 0, err
+				}
+			}
+		} else if len(keys) == 1 {
+			if err := setKeyProperty(params, g.keyProperty, keys[0]); err != nil {
+				return 0, 0, err
+			}
+		}
+		return int64(len(rows)), lastInsertId, nil
+	}
+
+	// 多个元素需要写回时，先读取自增的步长，读取失败时不执行插入
+	step := int64(1)
+	if items.IsValid() && countEmptyProperty(items, g.property()) > 1 {
+		if step, err = autoIncrementStep(); err != nil {
+			return 0, 0, err
+		}
+	}
+	result, err := database.Execute(CurrentExecutor(), sql, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if affected, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+	if lastInsertId, err = result.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+	// 没有自增列时LastInsertId为0
+	if lastInsertId == 0 {
+		return affected, lastInsertId, nil
+	}
+	if !items.IsValid() {
+		return affected, lastInsertId, setKeyProperty(params, g.keyProperty, lastInsertId)
+	}
+	next := lastInsertId
+	for i := 0; i < items.Len(); i++ {
+		elem := items.Index(i).Interface()
+		if !isEmptyProperty(elem, g.property()) {
+			continue
+		}
+		if _, _, err := setProperty(elem, g.property(), next); err != nil {
+			return 0, 0, err
+		}
+		next += step
+	}
+	return affected, lastInsertId, nil
+}
+
+// 写回多行插入的元素时使用的属性，即keyProperty的最后一段
+func (g *generatedKeys) property() string {
+	return g.keyProperty[strings.LastIndex(g.keyProperty, ".")+1:]
+}
+
+// 多行插入的元素，只有元素是结构体指针或map时才写回，否则返回无效的reflect.Value
+func (g *generatedKeys) items(collection reflect.Value) reflect.Value {
+	if !collection.IsValid() {
+		return reflect.Value{}
+	}
+	elemType := collection.Type().Elem()
+	if elemType.Kind() == reflect.Map || (elemType.Kind() == reflect.Ptr && elemType.Elem().Kind() == reflect.Struct) {
+		return collection
+	}
+	return reflect.Value{}
+}
+
+// 元素的属性是否为空，为空的元素才使用生成的主键
+func isEmptyProperty(target interface{}, name string) bool {
+	if m, ok := target.(map[string]interface{}); ok {
+		return m[name] == nil || reflect.ValueOf(m[name]).IsZero()
+	}
+	field, ok := findProperty(target, name)
+	return ok && field.IsZero()
+}
+
+// 需要写回主键的元素个数
+func countEmptyProperty(items reflect.Value, name string) int {
+	count := 0
+	for i := 0; i < items.Len(); i++ {
+		if isEmptyProperty(items.Index(i).Interface(), name) {
+			count++
+		}
+	}
+	return count
+}
+
+// mysql自增的步长，没有返回结果时为1
+func autoIncrementStep() (int64, error) {
+	rows, err := database.QueryMap(CurrentExecutor(), "select @@auto_increment_increment as step")
+	if err != nil {
+		return 0, fmt.Errorf("读取auto_increment_increment失败: %w", err)
+	}
+	if len(rows) == 0 {
+		return 1, nil
+	}
+	value := rows[0]["step"]
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	step, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil || step <= 0 {
+		return 0, fmt.Errorf("auto_increment_increment的值错误: %v", rows[0]["step"])
+	}
+	return step, nil
+}
@@ -0,0 +1,46 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"vodka/database"
+	"vodka/plugin/page"
+)
+
+// 参数中指定的锁，覆盖select的lock属性，通用Mapper的加锁查询由调用方传入
+const lockKey = "_lock"
+
+// 指定本次查询使用的锁
+func SetLock(params map[string]interface{}, lock database.Lock) {
+	params[lockKey] = lock
+}
+
+// 解析lock属性，只有select可以加锁
+func compileLock(attrs map[string]string, nodeName string) (database.Lock, error) {
+	value, ok := attrs["lock"]
+	if !ok {
+		return "", nil
+	}
+	if nodeName != "SELECT" {
+		return "", errors.New("只有select可以使用lock属性")
+	}
+	return database.ParseLock(value)
+}
+
+// 按方言在sql末尾追加加锁子句
+// 加锁的查询必须在事务中执行，否则语句结束时锁就释放了；分页插件会把语句包装为子查询，不能和锁一起使用
+func lockSql(sql string, lock database.Lock, params map[string]interface{}) (string, error) {
+	if override, ok := params[lockKey].(database.Lock); ok && override != "" {
+		lock = override
+	}
+	if lock == "" {
+		return sql, nil
+	}
+	if CurrentTx() == nil {
+		return "", fmt.Errorf("加锁的查询必须在事务中执行: for %s", lock)
+	}
+	if page.GetPageContext() != nil {
+		return "", errors.New("加锁的查询不能分页")
+	}
+	return sql + database.GetDialect().LockClause(lock), nil
+}
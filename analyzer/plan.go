@@ -0,0 +1,471 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"vodka/plugin"
+	runner "vodka/runner"
+	"vodka/xml"
+)
+
+// 匹配 #{abc.xxx} 和 ${abc.xxx} 格式的内容
+var placeholderRegexp = regexp.MustCompile(`(#|\$)\{([^}]+)\}`)
+
+// 执行计划
+// 每条语句在ScanMapper/InitMapper时被编译为执行计划：文本被预先拆分为片段，
+// 占位符和test表达式被预先解析为语法树，渲染时只需要求值
+type Plan struct {
+	nodes     []planNode
+	selectKey *selectKey // insert语句中的selectKey，没有时为nil
+}
+
+type planNode interface {
+	render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{})
+}
+
+// 编译语句节点
+func CompilePlan(node *xml.Node, root *xml.Node) (*Plan, error) {
+	nodes, err := compileChildren(node, root, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{nodes: nodes}
+	for _, child := range node.Children {
+		if child.Type != xml.Text && child.Name == "SELECTKEY" {
+			if plan.selectKey != nil {
+				return nil, errors.New("只能有一个selectKey")
+			}
+			if plan.selectKey, err = compileSelectKey(child, root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return plan, nil
+}
+
+// 渲染sql，返回参数化的sql和对应的参数
+func (p *Plan) Render(params map[string]interface{}) (sql string, args []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("渲染sql失败: %v", r)
+		}
+	}()
+	var builder strings.Builder
+	args = make([]interface{}, 0)
+	renderNodes(p.nodes, &builder, params, &args)
+	return builder.String(), args, nil
+}
+
+func renderNodes(nodes []planNode, builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	for _, node := range nodes {
+		node.render(builder, params, resultParams)
+	}
+}
+
+// including为正在展开的include，用于检测循环引用
+func compileChildren(node *xml.Node, root *xml.Node, including map[string]bool) ([]planNode, error) {
+	nodes := make([]planNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		compiled, err := compileNode(child, root, including)
+		if err != nil {
+			return nil, err
+		}
+		if compiled != nil {
+			nodes = append(nodes, compiled)
+		}
+	}
+	return nodes, nil
+}
+
+func compileNode(node *xml.Node, root *xml.Node, including map[string]bool) (planNode, error) {
+	if node.Type == xml.Text {
+		return compileText(node.Text)
+	}
+	switch node.Name {
+	case "IF":
+		return compileIf(node, root, including)
+	case "FOREACH":
+		return compileForeach(node, root, including)
+	case "WHERE":
+		children, err := compileChildren(node, root, including)
+		return &wherePlan{children: children, required: node.Attrs["required"] == "true"}, err
+	case "SET":
+		children, err := compileChildren(node, root, including)
+		return &setPlan{children: children}, err
+	case "TRIM":
+		return compileTrim(node, root, including)
+	case "SQL":
+		children, err := compileChildren(node, root, including)
+		return &sqlPlan{children: children}, err
+	case "INCLUDE":
+		return compileInclude(node, root, including)
+	case "SELECTKEY":
+		// 单独编译，不参与语句本身的渲染
+		return nil, nil
+	default:
+		// 自定义节点，处理器在渲染时再查找，允许在扫描之后注册
+		return &customPlan{node: node, root: root}, nil
+	}
+}
+
+// ---------------------- 文本 ----------------------
+
+// 文本片段，kind为0表示普通文本，'#'表示参数化占位符，'$'表示直接拼接
+type textSegment struct {
+	kind    byte
+	literal string
+	path    []string
+	expr    *runner.Expression
+}
+
+type textPlan struct {
+	segments []textSegment
+}
+
+func compileText(text string) (planNode, error) {
+	if text == "" {
+		return nil, nil
+	}
+	plan := &textPlan{}
+	last := 0
+	for _, match := range placeholderRegexp.FindAllStringSubmatchIndex(text, -1) {
+		if match[0] > last {
+			plan.segments = append(plan.segments, textSegment{literal: text[last:match[0]]})
+		}
+		last = match[1]
+		key := strings.TrimSpace(text[match[4]:match[5]])
+		segment := textSegment{kind: text[match[2]]}
+		// #{}中可以使用三元表达式和函数，${}只能取值
+		if segment.kind == '#' && (strings.Contains(key, "?") || strings.Contains(key, "(")) {
+			expr, err := runner.CompileExpression(key)
+			if err != nil {
+				return nil, err
+			}
+			segment.expr = expr
+		} else {
+			segment.path = runner.SplitPath(key)
+		}
+		plan.segments = append(plan.segments, segment)
+	}
+	if last < len(text) {
+		plan.segments = append(plan.segments, textSegment{literal: text[last:]})
+	}
+	return plan, nil
+}
+
+func (t *textPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	for _, segment := range t.segments {
+		switch segment.kind {
+		case 0:
+			builder.WriteString(segment.literal)
+		case '$':
+			// 处理 ${} 格式，直接拼接
+			builder.WriteString(fmt.Sprintf("%v", runner.GetPathValue(segment.path, params)))
+		default:
+			// 处理 #{} 格式，使用参数化查询
+			var value interface{}
+			if segment.expr != nil {
+				value = segment.expr.Evaluate(params)
+			} else {
+				value = encryptParam(segment.path, params, runner.GetPathValue(segment.path, params))
+			}
+			// 特殊情况，如果key为$AUTO，则自动生成id
+			if value == "$AUTO" {
+				builder.WriteString("DEFAULT")
+				continue
+			}
+			*resultParams = append(*resultParams, value)
+			builder.WriteString("?")
+		}
+	}
+}
+
+// ---------------------- if ----------------------
+
+type ifPlan struct {
+	test     *runner.Expression
+	children []planNode
+}
+
+func compileIf(node *xml.Node, root *xml.Node, including map[string]bool) (planNode, error) {
+	// 获取test属性的值
+	testExpr, ok := node.Attrs["test"]
+	if !ok {
+		return nil, errors.New("if语句缺少test属性")
+	}
+	test, err := runner.CompileExpression(testExpr)
+	if err != nil {
+		return nil, err
+	}
+	children, err := compileChildren(node, root, including)
+	if err != nil {
+		return nil, err
+	}
+	return &ifPlan{test: test, children: children}, nil
+}
+
+func (i *ifPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	// 如果表达式结果为true，则处理if语句的子节点
+	if i.test.Evaluate(params) != false {
+		renderNodes(i.children, builder, params, resultParams)
+	}
+}
+
+// ---------------------- foreach ----------------------
+
+type foreachPlan struct {
+	collection []string
+	item       string
+	separator  string
+	open       string
+	close      string
+	children   []planNode
+}
+
+func compileForeach(node *xml.Node, root *xml.Node, including map[string]bool) (planNode, error) {
+	plan := &foreachPlan{
+		collection: runner.SplitPath(attrOrDefault(node, "collection", "list")),
+		item:       attrOrDefault(node, "item", "item"),
+		separator:  attrOrDefault(node, "separator", ","),
+		open:       attrOrDefault(node, "open", ""),
+		close:      attrOrDefault(node, "close", ""),
+	}
+	children, err := compileChildren(node, root, including)
+	if err != nil {
+		return nil, err
+	}
+	plan.children = children
+	return plan, nil
+}
+
+func (f *foreachPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	collection := runner.GetPathValue(f.collection, params)
+	if collection == nil {
+		panic("集合不存在")
+	}
+	// 必须是slice或者array
+	collectionValue := reflect.ValueOf(collection)
+	if collectionValue.Kind() != reflect.Slice && collectionValue.Kind() != reflect.Array {
+		panic("集合类型错误")
+	}
+	builder.WriteString(f.open)
+	var childBuilder strings.Builder
+	written := false
+	for i := 0; i < collectionValue.Len(); i++ {
+		childBuilder.Reset()
+		params[f.item] = collectionValue.Index(i).Interface()
+		renderNodes(f.children, &childBuilder, params, resultParams)
+		if childBuilder.Len() == 0 {
+			continue
+		}
+		if written {
+			builder.WriteString(f.separator)
+		}
+		builder.WriteString(childBuilder.String())
+		written = true
+	}
+	builder.WriteString(f.close)
+}
+
+// ---------------------- where ----------------------
+
+type wherePlan struct {
+	children []planNode
+	required bool // 没有任何条件时报错，防止误删、误改整张表
+}
+
+func (w *wherePlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	// 移除第一个 "AND" 或 "OR"
+	sqlBuilder := strings.Builder{}
+	isFirstCondition := true
+	var childBuilder strings.Builder
+	for _, child := range w.children {
+		childBuilder.Reset()
+		child.render(&childBuilder, params, resultParams)
+
+		childSQL := strings.TrimSpace(childBuilder.String())
+		if childSQL == "" {
+			continue
+		}
+
+		if isFirstCondition {
+			childSQL = trimConjunction(childSQL)
+			isFirstCondition = false
+		}
+
+		sqlBuilder.WriteString(childSQL)
+		sqlBuilder.WriteString(" ")
+	}
+	childSql := strings.TrimSpace(sqlBuilder.String())
+	if childSql != "" {
+		builder.WriteString(" where ")
+		builder.WriteString(childSql)
+		builder.WriteByte(' ')
+	} else if w.required {
+		panic("缺少where条件")
+	}
+}
+
+// 去掉开头的and或or
+func trimConjunction(sql string) string {
+	for _, conjunction := range []string{"AND", "OR"} {
+		if len(sql) < len(conjunction) || !strings.EqualFold(sql[:len(conjunction)], conjunction) {
+			continue
+		}
+		rest := sql[len(conjunction):]
+		if rest == "" || rest[0] == ' ' || rest[0] == '(' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r' {
+			return strings.TrimSpace(rest)
+		}
+	}
+	return sql
+}
+
+// ---------------------- set ----------------------
+
+type setPlan struct {
+	children []planNode
+}
+
+func (s *setPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	builder.WriteString(" set ")
+	var childBuilder strings.Builder
+	// 移除末尾的逗号
+	renderNodes(s.children, &childBuilder, params, resultParams)
+	childSQL := strings.TrimSpace(childBuilder.String())
+	childSQL = strings.TrimSuffix(childSQL, ",")
+	builder.WriteString(childSQL)
+	builder.WriteString(" ")
+}
+
+// ---------------------- trim ----------------------
+
+// 内容不为空时，去掉开头和结尾指定的内容，再加上前缀和后缀
+// prefixOverrides和suffixOverrides可以用|分隔多个，忽略大小写
+type trimPlan struct {
+	prefix          string
+	suffix          string
+	prefixOverrides []string
+	suffixOverrides []string
+	children        []planNode
+}
+
+func compileTrim(node *xml.Node, root *xml.Node, including map[string]bool) (planNode, error) {
+	children, err := compileChildren(node, root, including)
+	if err != nil {
+		return nil, err
+	}
+	return &trimPlan{
+		prefix:          node.Attrs["prefix"],
+		suffix:          node.Attrs["suffix"],
+		prefixOverrides: splitOverrides(node.Attrs["prefixOverrides"]),
+		suffixOverrides: splitOverrides(node.Attrs["suffixOverrides"]),
+		children:        children,
+	}, nil
+}
+
+func splitOverrides(overrides string) []string {
+	var result []string
+	for _, override := range strings.Split(overrides, "|") {
+		if override = strings.TrimSpace(override); override != "" {
+			result = append(result, override)
+		}
+	}
+	return result
+}
+
+func (t *trimPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	var childBuilder strings.Builder
+	renderNodes(t.children, &childBuilder, params, resultParams)
+	content := strings.TrimSpace(childBuilder.String())
+	for _, override := range t.prefixOverrides {
+		if len(content) < len(override) || !strings.EqualFold(content[:len(override)], override) {
+			continue
+		}
+		// and不能匹配到android这样的单词
+		rest := content[len(override):]
+		if rest == "" || !isWordChar(rest[0]) || !isWordChar(override[len(override)-1]) {
+			content = strings.TrimSpace(rest)
+			break
+		}
+	}
+	for _, override := range t.suffixOverrides {
+		if len(content) < len(override) || !strings.EqualFold(content[len(content)-len(override):], override) {
+			continue
+		}
+		rest := content[:len(content)-len(override)]
+		if rest == "" || !isWordChar(rest[len(rest)-1]) || !isWordChar(override[0]) {
+			content = strings.TrimSpace(rest)
+			break
+		}
+	}
+	if content == "" {
+		return
+	}
+	builder.WriteString(" " + t.prefix)
+	builder.WriteString(content)
+	builder.WriteString(t.suffix + " ")
+}
+
+// ---------------------- sql / include ----------------------
+
+type sqlPlan struct {
+	children []planNode
+}
+
+func (s *sqlPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	renderNodes(s.children, builder, params, resultParams)
+}
+
+func compileInclude(node *xml.Node, root *xml.Node, including map[string]bool) (planNode, error) {
+	// 获取include的id
+	refid, ok := node.Attrs["refid"]
+	if !ok {
+		return nil, nil
+	}
+	if including[refid] {
+		return nil, fmt.Errorf("include %s 存在循环引用", refid)
+	}
+	// 查找root中是否有符合id的节点
+	for _, child := range root.Children {
+		// 不能是自身
+		if child.Attrs["id"] != refid || child == node {
+			continue
+		}
+		nested := make(map[string]bool, len(including)+1)
+		for k := range including {
+			nested[k] = true
+		}
+		nested[refid] = true
+		return compileNode(child, root, nested)
+	}
+	return nil, fmt.Errorf("include的refid %s 不存在", refid)
+}
+
+// ---------------------- 自定义标签 ----------------------
+
+type customPlan struct {
+	node *xml.Node
+	root *xml.Node
+}
+
+func (c *customPlan) render(builder *strings.Builder, params map[string]interface{}, resultParams *[]interface{}) {
+	handler, ok := plugin.GetTagHandler(c.node.Name)
+	if !ok {
+		panic(fmt.Sprintf("未找到标签处理器: %s", c.node.Name))
+	}
+	handler(builder, c.node, params, resultParams, c.root)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func attrOrDefault(node *xml.Node, name, defaultValue string) string {
+	if value, ok := node.Attrs[name]; ok {
+		return value
+	}
+	return defaultValue
+}
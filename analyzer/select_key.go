@@ -0,0 +1,181 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	database "vodka/database"
+	runner "vodka/runner"
+	"vodka/util"
+	"vodka/xml"
+)
+
+// insert语句中的selectKey，用于在插入前后查询主键并设置到参数中
+// <selectKey keyProperty="id" order="BEFORE"> select nextval('user_seq') </selectKey>
+// order为BEFORE时在插入前执行，AFTER（默认）时在插入后、同一个连接上执行
+// keyProperty为参数中的属性，可以是 user.id 这样的路径；查询返回多列时需要用keyColumn指定列名
+type selectKey struct {
+	keyProperty string
+	keyColumn   string
+	before      bool
+	plan        *Plan
+}
+
+func compileSelectKey(node *xml.Node, root *xml.Node) (*selectKey, error) {
+	keyProperty := node.Attrs["keyProperty"]
+	if keyProperty == "" {
+		return nil, errors.New("selectKey必须有keyProperty属性")
+	}
+	order := strings.ToUpper(attrOrDefault(node, "order", "AFTER"))
+	if order != "BEFORE" && order != "AFTER" {
+		return nil, fmt.Errorf("selectKey的order必须是BEFORE或AFTER: %s", order)
+	}
+	children, err := compileChildren(node, root, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &selectKey{
+		keyProperty: keyProperty,
+		keyColumn:   node.Attrs["keyColumn"],
+		before:      order == "BEFORE",
+		plan:        &Plan{nodes: children},
+	}, nil
+}
+
+// 在插入前后执行selectKey，AFTER时插入和查询在同一个事务中，保证使用同一个连接
+func (k *selectKey) wrap(params map[string]interface{}, execute func() error) error {
+	if k.before {
+		if err := k.query(params); err != nil {
+			return err
+		}
+		return execute()
+	}
+	return Transaction(func() error {
+		if err := execute(); err != nil {
+			return err
+		}
+		return k.query(params)
+	})
+}
+
+func (k *selectKey) query(params map[string]interface{}) error {
+	sql, args, err := k.plan.Render(params)
+	if err != nil {
+		return err
+	}
+	rows, err := database.QueryMap(CurrentExecutor(), sql, args...)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("selectKey没有返回结果: %s", sql)
+	}
+	var value interface{}
+	if k.keyColumn != "" {
+		var ok bool
+		if value, ok = rows[0][k.keyColumn]; !ok {
+			return fmt.Errorf("selectKey的结果中没有列 %s", k.keyColumn)
+		}
+	} else if len(rows[0]) != 1 {
+		return errors.New("selectKey返回了多列，需要使用keyColumn指定列名")
+	} else {
+		for _, v := range rows[0] {
+			value = v
+		}
+	}
+	return setKeyProperty(params, k.keyProperty, value)
+}
+
+// 设置参数中的主键，并写回传入的结构体指针或map
+// 属性没有路径时，只写回被展开的参数中包含该属性的结构体指针或map，有多个时无法确定写回哪一个，返回错误
+func setKeyProperty(params map[string]interface{}, keyProperty string, value interface{}) error {
+	path := strings.Split(keyProperty, ".")
+	if len(path) == 1 {
+		var targets []interface{}
+		if expanded, ok := params[expandedKey].(*expandedObjects); ok {
+			for _, object := range expanded.objects {
+				if _, ok := object.(map[string]interface{}); ok {
+					targets = append(targets, object)
+				} else if _, ok := findProperty(object, keyProperty); ok {
+					targets = append(targets, object)
+				}
+			}
+		}
+		if len(targets) > 1 {
+			return fmt.Errorf("有多个参数包含属性 %s，请使用 参数名.%s 指定写回的参数", keyProperty, keyProperty)
+		}
+		// 写回结构体时，参数使用转换为字段类型之后的值
+		converted := value
+		if len(targets) == 1 {
+			assigned, _, err := setProperty(targets[0], keyProperty, value)
+			if err != nil {
+				return err
+			}
+			converted = assigned
+		}
+		params[keyProperty] = converted
+		return nil
+	}
+	target := params[path[0]]
+	for _, name := range path[1 : len(path)-1] {
+		target = getProperty(target, name)
+	}
+	_, ok, err := setProperty(target, path[len(path)-1], value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("无法设置selectKey的属性 %s", keyProperty)
+	}
+	return nil
+}
+
+func getProperty(target interface{}, name string) interface{} {
+	if m, ok := target.(map[string]interface{}); ok {
+		return m[name]
+	}
+	if field, ok := findProperty(target, name); ok {
+		return field.Interface()
+	}
+	return nil
+}
+
+// 设置结构体指针的字段或map的键，返回设置后的值，target不包含该属性时返回false
+func setProperty(target interface{}, name string, value interface{}) (interface{}, bool, error) {
+	if m, ok := target.(map[string]interface{}); ok {
+		m[name] = value
+		return value, true, nil
+	}
+	field, ok := findProperty(target, name)
+	if !ok {
+		return nil, false, nil
+	}
+	if err := util.AssignValue(field, value); err != nil {
+		return nil, false, fmt.Errorf("selectKey的结果不能赋值给 %s: %w", name, err)
+	}
+	return runner.FieldValue(field), true, nil
+}
+
+// 按vo标签或字段名查找结构体指针中的字段
+func findProperty(target interface{}, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if util.VoIgnored(field.Tag.Get("vo")) {
+			continue
+		}
+		key := util.VoName(field.Tag.Get("vo"))
+		if key == "" {
+			key = field.Name
+		}
+		if key == name && field.IsExported() {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	database "vodka/database"
+	mysqld "vodka/database/mysql"
+	"vodka/util"
+)
+
+// 当前协程的事务
+var txLocal = util.NewThreadLocal(false)
+
+// 在事务中执行fn，fn返回错误或者panic时回滚，否则提交
+// 事务绑定在当前协程上，fn中通过mapper执行的语句都会使用该事务，fn中新开的协程不在事务内
+// 如果当前协程已经在事务中，则直接加入该事务
+func Transaction(fn func() error) (err error) {
+	if _, ok := txLocal.Get(); ok {
+		return fn()
+	}
+	tx, err := database.Begin(mysqld.GetDB())
+	if err != nil {
+		return err
+	}
+	txLocal.Set(tx)
+	defer txLocal.Remove()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 获取当前协程的事务，不在事务中时返回nil
+func CurrentTx() *database.Tx {
+	tx, ok := txLocal.Get()
+	if !ok {
+		return nil
+	}
+	return tx.(*database.Tx)
+}
+
+// 当前协程应该使用的执行者，在事务中时使用事务，否则使用数据源
+func CurrentExecutor() database.Executor {
+	if tx := CurrentTx(); tx != nil {
+		return tx
+	}
+	return mysqld.GetDB()
+}
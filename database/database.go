@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"strconv"
 	mysqld "vodka/database/mysql"
+	"vodka/encrypt"
+	"vodka/util"
 )
 
 // 连接SQLite数据库
@@ -27,8 +29,8 @@ func ConnectMySQL(dsn string) (*sql.DB, error) {
 }
 
 // 正常的查询map接口
-func QueryMap(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := db.Query(query, args...)
+func QueryMap(db Executor, sql string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := query(db, sql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -69,12 +71,17 @@ func QueryMap(db *sql.DB, query string, args ...interface{}) ([]map[string]inter
 	return maps, nil
 }
 
-func Execute(db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
-	return db.Exec(query, args...)
+func Execute(db Executor, query string, args ...interface{}) (sql.Result, error) {
+	return exec(db, query, args...)
 }
 
-func ExecuteInt64(db *sql.DB, query string, args []interface{}, dest []interface{}) error {
-	sqlResult, err := db.Exec(query, args...)
+// 执行查询，开启了预编译语句缓存时使用缓存的语句
+func Query(db Executor, sql string, args ...interface{}) (*sql.Rows, error) {
+	return query(db, sql, args...)
+}
+
+func ExecuteInt64(db Executor, query string, args []interface{}, dest []interface{}) error {
+	sqlResult, err := exec(db, query, args...)
 	if err != nil {
 		return err
 	}
@@ -89,7 +96,12 @@ func ExecuteInt64(db *sql.DB, query string, args []interface{}, dest []interface
 		return err
 	}
 
-	//按照影响的行数、最后插入的id以此进行赋值，如果int64的个数超过了2，后续的都忽略
+	SetExecResult(dest, affected, lastInsertId)
+	return nil
+}
+
+// 按照影响的行数、最后插入的id依次进行赋值，如果int64的个数超过了2，后续的都忽略
+func SetExecResult(dest []interface{}, affected int64, lastInsertId int64) {
 	useAffected := false
 	for _, _dest := range dest {
 		destValue := reflect.ValueOf(_dest)
@@ -102,16 +114,16 @@ func ExecuteInt64(db *sql.DB, query string, args []interface{}, dest []interface
 			}
 		}
 	}
-
-	return nil
 }
 
 // dest中目前只允许有以下几种可能：
 // 1. 指向切片的指针, 如：&[]User{}, 表示直接查出一个列表，最常用的用法
 // 2. 指向结构体的指针, 如：&User{}, 如果列表个数唯一，则直接赋值，如果列表个数大于1，则返回报错
-// 3. 因为返回值已经有了error，所以不允许这里再出现error
+// 3. 指向int64的指针，表示count查询；指向bool的指针，表示是否存在
+// 4. 指向float64或interface{}的指针，表示聚合查询，取第一行第一列；指向[]map[string]interface{}的指针，直接返回每一行
+// 5. 因为返回值已经有了error，所以不允许这里再出现error
 // todo: 指向map的后续再加
-func QueryStruct(db *sql.DB, query string, args []interface{}, dest []interface{}) error {
+func QueryStruct(db Executor, query string, args []interface{}, dest []interface{}) error {
 	// 先查个map出来
 	maps, err := QueryMap(db, query, args...)
 	if err != nil {
@@ -125,6 +137,15 @@ func QueryStruct(db *sql.DB, query string, args []interface{}, dest []interface{
 			// 获取切片的元素类型
 			sliceElemType := destValue.Elem().Type().Elem()
 
+			// 元素为map时直接返回查询结果
+			if sliceElemType == mapType {
+				if maps == nil {
+					maps = make([]map[string]interface{}, 0)
+				}
+				destValue.Elem().Set(reflect.ValueOf(maps))
+				continue
+			}
+
 			// 创建新的切片
 			newSlice := reflect.MakeSlice(reflect.SliceOf(sliceElemType), 0, len(maps))
 
@@ -132,31 +153,8 @@ func QueryStruct(db *sql.DB, query string, args []interface{}, dest []interface{
 			for _, m := range maps {
 				// 创建新的结构体实例
 				newElemPtr := reflect.New(sliceElemType.Elem())
-				newElem := newElemPtr.Elem()
-
-				// 遍历结构体的字段
-				for i := 0; i < newElem.NumField(); i++ {
-					field := newElem.Type().Field(i)
-					// 获取字段名，优先使用 vo 标签
-					fieldName := field.Name
-					if voTag := field.Tag.Get("vo"); voTag != "" {
-						fieldName = voTag
-					}
-
-					// 如果map中存在对应的键，则设置字段值
-					if value, ok := m[fieldName]; ok {
-						// 特殊处理一下，如果是string类型，是不能设置为nil的
-						if value == nil {
-							if field.Type.Kind() == reflect.String {
-								value = ""
-							}
-						}
-						// 将interface{}转换为字段类型
-						fieldValue := reflect.ValueOf(value)
-						if fieldValue.Type().ConvertibleTo(field.Type) {
-							newElem.Field(i).Set(fieldValue.Convert(field.Type))
-						}
-					}
+				if err := ScanStruct(m, newElemPtr.Elem()); err != nil {
+					return err
 				}
 
 				// 将新的结构体添加到切片中
@@ -191,6 +189,25 @@ func QueryStruct(db *sql.DB, query string, args []interface{}, dest []interface{
 			} else {
 				destValue.Elem().Set(reflect.Zero(destValue.Elem().Type()))
 			}
+		} else if destValue.Kind() == reflect.Ptr && destValue.Elem().Kind() == reflect.Bool {
+			// bool类型表示是否存在，有任意一行即为true
+			destValue.Elem().SetBool(len(maps) > 0)
+		} else if destValue.Kind() == reflect.Ptr && destValue.Elem().Kind() == reflect.Float64 {
+			// float64类型为sum、avg等聚合查询，没有结果或者为NULL时为0
+			var ret float64
+			if value := firstValue(maps); value != nil {
+				if ret, err = toFloat64(value); err != nil {
+					return err
+				}
+			}
+			destValue.Elem().SetFloat(ret)
+		} else if destValue.Kind() == reflect.Ptr && destValue.Elem().Kind() == reflect.Interface {
+			// interface{}类型为max、min等聚合查询，返回第一行第一列的原始值
+			if value := firstValue(maps); value != nil {
+				destValue.Elem().Set(reflect.ValueOf(value))
+			} else {
+				destValue.Elem().Set(reflect.Zero(destValue.Elem().Type()))
+			}
 		} else if destValue.Kind() == reflect.Ptr && destValue.Elem().Elem().Kind() == reflect.Struct {
 			// 这里必须用指针的指针进行判断
 			// 如果maps只有一个，则映射到结构体
@@ -199,26 +216,9 @@ func QueryStruct(db *sql.DB, query string, args []interface{}, dest []interface{
 				// dest[0] = nil
 				destValue.Elem().Set(reflect.Zero(destValue.Elem().Type()))
 			} else {
-				m := maps[0]
-				// 遍历结构体的字段
 				// 指针的指针进行变形
-				destValue = destValue.Elem()
-				for i := 0; i < destValue.Elem().NumField(); i++ {
-					field := destValue.Elem().Type().Field(i)
-					// 获取字段名，优先使用 vo 标签
-					fieldName := field.Name
-					if voTag := field.Tag.Get("vo"); voTag != "" {
-						fieldName = voTag
-					}
-
-					// 如果map中存在对应的键，则设置字段值
-					if value, ok := m[fieldName]; ok {
-						// 将interface{}转换为字段类型
-						fieldValue := reflect.ValueOf(value)
-						if fieldValue.Type().ConvertibleTo(field.Type) {
-							destValue.Elem().Field(i).Set(fieldValue.Convert(field.Type))
-						}
-					}
+				if err := ScanStruct(maps[0], destValue.Elem().Elem()); err != nil {
+					return err
 				}
 			}
 		}
@@ -272,3 +272,80 @@ func SetDB(db *sql.DB) {
 	// 默认使用mysql
 	mysqld.SetDB(db)
 }
+
+var mapType = reflect.TypeOf(map[string]interface{}{})
+
+// 将一行查询结果按vo标签（没有时为字段名）设置到结构体中，structValue必须是可以设置的结构体
+// 声明了encrypt的列在设置前解密
+func ScanStruct(m map[string]interface{}, structValue reflect.Value) error {
+	structType := structValue.Type()
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structType.Field(i)
+		if util.VoIgnored(field.Tag.Get("vo")) || !field.IsExported() {
+			continue
+		}
+		// 获取字段名，优先使用 vo 标签
+		fieldName := field.Name
+		if voTag := util.VoName(field.Tag.Get("vo")); voTag != "" {
+			fieldName = voTag
+		}
+		// 如果map中存在对应的键，则设置字段值
+		if value, ok := m[fieldName]; ok {
+			if encrypted, _ := util.VoEncrypt(field.Tag.Get("vo")); encrypted && value != nil {
+				plaintext, err := encrypt.Decrypt(fmt.Sprintf("%s", value))
+				if err != nil {
+					return fmt.Errorf("解密列 %s 失败: %w", fieldName, err)
+				}
+				value = plaintext
+			}
+			setFieldValue(structValue.Field(i), value)
+		}
+	}
+	return nil
+}
+
+// 第一行第一列的值，没有结果时为nil
+func firstValue(maps []map[string]interface{}) interface{} {
+	if len(maps) == 0 {
+		return nil
+	}
+	for _, v := range maps[0] {
+		return v
+	}
+	return nil
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		return float64(reflect.ValueOf(v).Int()), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return float64(reflect.ValueOf(v).Uint()), nil
+	case float32, float64:
+		return reflect.ValueOf(v).Float(), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("无法转换类型 %T 为 float64", value)
+}
+
+// 将查询结果设置到结构体字段，NULL设置为零值，指针字段为NULL时为nil，否则分配新的值
+func setFieldValue(field reflect.Value, value interface{}) {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		setFieldValue(elem.Elem(), value)
+		field.Set(elem)
+		return
+	}
+	// 将interface{}转换为字段类型，不能直接转换时按字符串解析，如decimal列返回的字符串
+	fieldValue := reflect.ValueOf(value)
+	if fieldValue.Type().ConvertibleTo(field.Type()) {
+		field.Set(fieldValue.Convert(field.Type()))
+	} else {
+		_ = util.AssignValue(field, value)
+	}
+}
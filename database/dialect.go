@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 数据库方言，通用Mapper根据方言生成不同的语句
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	PostgreSQL
+	SQLite
+)
+
+var dialect = MySQL
+
+// 设置方言，需要在InitMapper之前调用，已经生成的语句不会改变
+func SetDialect(d Dialect) {
+	dialect = d
+}
+
+func GetDialect() Dialect {
+	return dialect
+}
+
+func (d Dialect) String() string {
+	switch d {
+	case MySQL:
+		return "mysql"
+	case PostgreSQL:
+		return "postgresql"
+	case SQLite:
+		return "sqlite"
+	}
+	return "unknown"
+}
+
+// 插入冲突时更新的子句，conflict为冲突的唯一键，updates为冲突时需要更新的列
+// updates为空时，冲突的行保持不变
+func (d Dialect) UpsertClause(conflict []string, updates []string) string {
+	var builder strings.Builder
+	if d == MySQL {
+		builder.WriteString(" on duplicate key update ")
+		if len(updates) == 0 {
+			// mysql必须至少更新一列，更新为自身等价于忽略
+			builder.WriteString(conflict[0] + " = " + conflict[0])
+			return builder.String()
+		}
+		for i, column := range updates {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(column + " = values(" + column + ")")
+		}
+		return builder.String()
+	}
+	builder.WriteString(" on conflict (" + strings.Join(conflict, ",") + ") ")
+	if len(updates) == 0 {
+		builder.WriteString("do nothing")
+		return builder.String()
+	}
+	builder.WriteString("do update set ")
+	for i, column := range updates {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(column + " = excluded." + column)
+	}
+	return builder.String()
+}
+
+// 将insert into语句改写为冲突时忽略的语句
+func (d Dialect) InsertIgnore(insertSql string) string {
+	if d == MySQL {
+		return strings.Replace(insertSql, "insert into", "insert ignore into", 1)
+	}
+	return insertSql + " on conflict do nothing"
+}
+
+// 是否支持insert ... returning，支持时插入后通过returning获取生成的主键
+func (d Dialect) SupportsReturning() bool {
+	return d == PostgreSQL || d == SQLite
+}
+
+// like使用\转义时需要追加的子句，mysql和postgresql默认使用\转义，sqlite需要显式指定
+func (d Dialect) LikeEscape() string {
+	if d == SQLite {
+		return ` escape '\'`
+	}
+	return ""
+}
+
+// 悲观锁，查询时锁定读取的行，直到事务结束
+type Lock string
+
+const (
+	ForUpdate           Lock = "update"
+	ForUpdateNowait     Lock = "update nowait"
+	ForUpdateSkipLocked Lock = "update skip locked"
+	ForShare            Lock = "share"
+	ForShareNowait      Lock = "share nowait"
+	ForShareSkipLocked  Lock = "share skip locked"
+)
+
+// 解析xml中select的lock属性，如 update、share、update skip locked
+func ParseLock(s string) (Lock, error) {
+	lock := Lock(strings.Join(strings.Fields(strings.ToLower(s)), " "))
+	switch lock {
+	case ForUpdate, ForUpdateNowait, ForUpdateSkipLocked, ForShare, ForShareNowait, ForShareSkipLocked:
+		return lock, nil
+	}
+	return "", fmt.Errorf("不支持的锁: %s，只能是update或share，可以追加nowait或skip locked", s)
+}
+
+// 追加在select末尾的加锁子句，mysql 8.0和postgresql语法相同
+// sqlite没有行锁，事务写入时锁定整个数据库，返回空
+func (d Dialect) LockClause(lock Lock) string {
+	if lock == "" || d == SQLite {
+		return ""
+	}
+	return " for " + string(lock)
+}
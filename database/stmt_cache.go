@@ -0,0 +1,167 @@
+package database
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// 预编译语句缓存
+// 以渲染后的sql为key，缓存*sql.Stmt，超过容量时淘汰最久未使用的语句
+// 默认不开启，通过EnableStmtCache为数据源开启
+type StmtCache struct {
+	prepare  func(query string) (*sql.Stmt, error)
+	capacity int
+
+	mu        sync.Mutex
+	list      *list.List
+	items     map[string]*list.Element
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// 缓存的统计信息
+type StmtCacheStats struct {
+	Capacity  int   // 容量
+	Size      int   // 当前缓存的语句数
+	Hits      int64 // 命中次数
+	Misses    int64 // 未命中次数，即prepare的次数
+	Evictions int64 // 淘汰次数
+}
+
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int  // 正在使用该语句的调用数
+	evicted bool // 已被淘汰，引用归零后关闭
+}
+
+// 每个数据源的缓存
+var stmtCaches sync.Map
+
+func NewStmtCache(capacity int, prepare func(query string) (*sql.Stmt, error)) *StmtCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &StmtCache{
+		prepare:  prepare,
+		capacity: capacity,
+		list:     list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// 为数据源开启预编译语句缓存，capacity为最多缓存的语句数
+func EnableStmtCache(db *sql.DB, capacity int) {
+	cache := NewStmtCache(capacity, db.Prepare)
+	if old, loaded := stmtCaches.Swap(db, cache); loaded {
+		old.(*StmtCache).Close()
+	}
+}
+
+// 关闭数据源的预编译语句缓存，并关闭所有缓存的语句
+func DisableStmtCache(db *sql.DB) {
+	if old, loaded := stmtCaches.LoadAndDelete(db); loaded {
+		old.(*StmtCache).Close()
+	}
+}
+
+// 获取数据源缓存的统计信息，没有开启缓存时返回false
+func GetStmtCacheStats(db *sql.DB) (StmtCacheStats, bool) {
+	cache := getStmtCache(db)
+	if cache == nil {
+		return StmtCacheStats{}, false
+	}
+	return cache.Stats(), true
+}
+
+func getStmtCache(db *sql.DB) *StmtCache {
+	cache, ok := stmtCaches.Load(db)
+	if !ok {
+		return nil
+	}
+	return cache.(*StmtCache)
+}
+
+func (c *StmtCache) Stats() StmtCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return StmtCacheStats{
+		Capacity:  c.capacity,
+		Size:      c.list.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// 获取语句，使用完毕后必须调用release
+func (c *StmtCache) acquire(query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	if element, ok := c.items[query]; ok {
+		c.hits++
+		c.list.MoveToFront(element)
+		entry := element.Value.(*cachedStmt)
+		entry.refs++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// prepare需要和数据库交互，不在锁内进行
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 其他协程可能已经放入了相同的语句
+	if element, ok := c.items[query]; ok {
+		stmt.Close()
+		c.list.MoveToFront(element)
+		entry := element.Value.(*cachedStmt)
+		entry.refs++
+		return entry, nil
+	}
+	entry := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.list.PushFront(entry)
+	for c.list.Len() > c.capacity {
+		oldest := c.list.Back()
+		c.removeElement(oldest)
+		c.evictions++
+	}
+	return entry, nil
+}
+
+func (c *StmtCache) release(entry *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// 需要持有锁
+func (c *StmtCache) removeElement(element *list.Element) {
+	entry := element.Value.(*cachedStmt)
+	c.list.Remove(element)
+	delete(c.items, entry.query)
+	entry.evicted = true
+	// 仍在使用中的语句等到release时再关闭
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// 关闭所有缓存的语句
+func (c *StmtCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.list.Len() > 0 {
+		c.removeElement(c.list.Back())
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// 可以执行sql的对象，*sql.DB、*sql.Tx和*Tx都实现了该接口
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// 事务
+// 数据源开启了缓存时，事务内的预编译语句单独缓存，事务结束时统一关闭；没有开启时直接执行，不额外prepare
+type Tx struct {
+	*sql.Tx
+	cache   *StmtCache
+	parents []*cachedStmt // 借用的数据源语句，事务结束时归还
+	dbCache *StmtCache
+	caching int // CacheStmts的嵌套层数
+}
+
+// 事务内缓存的语句数
+const txStmtCacheCapacity = 64
+
+func Begin(db *sql.DB) (*Tx, error) {
+	sqlTx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	tx := &Tx{Tx: sqlTx, dbCache: getStmtCache(db)}
+	tx.cache = NewStmtCache(txStmtCacheCapacity, tx.prepare)
+	return tx, nil
+}
+
+// 如果数据源开启了缓存，复用数据源上已经预编译的语句，否则在事务的连接上预编译
+func (tx *Tx) prepare(query string) (*sql.Stmt, error) {
+	if tx.dbCache == nil {
+		return tx.Tx.Prepare(query)
+	}
+	parent, err := tx.dbCache.acquire(query)
+	if err != nil {
+		return nil, err
+	}
+	// 父语句在事务结束前不能被关闭
+	tx.parents = append(tx.parents, parent)
+	return tx.Tx.Stmt(parent.stmt), nil
+}
+
+// 在fn执行期间，即使数据源没有开启缓存，事务内相同的语句也只预编译一次
+// 用于batch执行器反复执行同一条语句
+func (tx *Tx) CacheStmts(fn func() error) error {
+	tx.caching++
+	defer func() { tx.caching-- }()
+	return fn()
+}
+
+func (tx *Tx) useCache() bool {
+	return tx.dbCache != nil || tx.caching > 0
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if !tx.useCache() {
+		return tx.Tx.Exec(query, args...)
+	}
+	entry, err := tx.cache.acquire(query)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.cache.release(entry)
+	return entry.stmt.Exec(args...)
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if !tx.useCache() {
+		return tx.Tx.Query(query, args...)
+	}
+	entry, err := tx.cache.acquire(query)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.cache.release(entry)
+	return entry.stmt.Query(args...)
+}
+
+// 事务内缓存的统计信息
+func (tx *Tx) Stats() StmtCacheStats {
+	return tx.cache.Stats()
+}
+
+func (tx *Tx) Commit() error {
+	defer tx.close()
+	return tx.Tx.Commit()
+}
+
+func (tx *Tx) Rollback() error {
+	defer tx.close()
+	return tx.Tx.Rollback()
+}
+
+func (tx *Tx) close() {
+	tx.cache.Close()
+	for _, parent := range tx.parents {
+		tx.dbCache.release(parent)
+	}
+	tx.parents = nil
+}
+
+// 如果数据源开启了缓存，使用缓存的语句执行
+func query(db Executor, query string, args ...interface{}) (*sql.Rows, error) {
+	if sqlDB, ok := db.(*sql.DB); ok {
+		if cache := getStmtCache(sqlDB); cache != nil {
+			entry, err := cache.acquire(query)
+			if err != nil {
+				return nil, err
+			}
+			defer cache.release(entry)
+			return entry.stmt.Query(args...)
+		}
+	}
+	return db.Query(query, args...)
+}
+
+func exec(db Executor, query string, args ...interface{}) (sql.Result, error) {
+	if sqlDB, ok := db.(*sql.DB); ok {
+		if cache := getStmtCache(sqlDB); cache != nil {
+			entry, err := cache.acquire(query)
+			if err != nil {
+				return nil, err
+			}
+			defer cache.release(entry)
+			return entry.stmt.Exec(args...)
+		}
+	}
+	return db.Exec(query, args...)
+}
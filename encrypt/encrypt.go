@@ -0,0 +1,164 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 列加密的密钥，加密时使用当前的密钥，解密时按密文前缀中的id查找密钥，从而支持密钥轮换
+// 密钥长度必须是16、24或32字节，对应AES-128、AES-192、AES-256
+// 注意：确定性加密的密文和密钥id有关，轮换后相同的明文会得到不同的密文，等值查询只能匹配用当前密钥写入的行
+// 轮换确定性加密的列时，需要先用新密钥重新加密已有的数据，再切换CurrentKey
+type KeyProvider interface {
+	// 当前用于加密的密钥和它的id，id不能包含冒号
+	CurrentKey() (id string, key []byte, err error)
+	// 按id查找解密用的密钥，轮换后旧的密钥仍然需要能够找到
+	Key(id string) ([]byte, error)
+}
+
+// 没有注册KeyProvider
+var ErrNoKeyProvider = errors.New("没有注册KeyProvider，请先调用RegisterKeyProvider")
+
+var (
+	providerLock sync.RWMutex
+	provider     KeyProvider
+)
+
+// 注册密钥，vo标签中声明了encrypt的列使用该密钥加解密
+func RegisterKeyProvider(keyProvider KeyProvider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = keyProvider
+}
+
+func currentProvider() (KeyProvider, error) {
+	providerLock.RLock()
+	defer providerLock.RUnlock()
+	if provider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	return provider, nil
+}
+
+// 固定的密钥集合，current为加密使用的密钥id
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (s *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("密钥 %s 不存在", id)
+	}
+	return key, nil
+}
+
+// 加密，结果为 密钥id:base64(nonce+密文)
+// deterministic为true时nonce为明文的HMAC，相同的明文和密钥得到相同的密文，可以用于等值查询
+func Encrypt(plaintext string, deterministic bool) (string, error) {
+	keyProvider, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	id, key, err := keyProvider.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(id, ":") {
+		return "", fmt.Errorf("密钥id不能包含冒号: %s", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, deriveNonceKey(key))
+		mac.Write([]byte(plaintext))
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(id))
+	return id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// 解密Encrypt的结果，按前缀中的id查找密钥
+func Decrypt(ciphertext string) (string, error) {
+	id, encoded, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return "", errors.New("密文格式错误，缺少密钥id")
+	}
+	keyProvider, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := keyProvider.Key(id)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("密文格式错误: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("密文格式错误，长度不足")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("使用密钥 %s 解密失败: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// 计算确定性nonce的HMAC密钥，使用HKDF-SHA256（RFC 5869）从列加密的密钥派生，不和AES-GCM共用同一个密钥
+// 输出只需要一个块，expand只计算T(1)
+const nonceKeyInfo = "vodka/encrypt deterministic nonce"
+
+func deriveNonceKey(key []byte) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(key)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(nonceKeyInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 加密绑定到sql中的参数，nil表示NULL，不加密；只支持字符串和[]byte
+func Value(value interface{}, deterministic bool) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return Encrypt(v, deterministic)
+	case []byte:
+		return Encrypt(string(v), deterministic)
+	}
+	return nil, fmt.Errorf("加密的列只支持字符串，实际为 %T", value)
+}
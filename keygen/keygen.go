@@ -0,0 +1,128 @@
+package keygen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 主键生成器，生成的值会被转换为主键字段的类型
+type Generator func() (interface{}, error)
+
+var generators = sync.Map{}
+
+func init() {
+	Register("snowflake", func() (interface{}, error) { return NextSnowflake() })
+	Register("uuid", func() (interface{}, error) { return NewUUID() })
+	Register("ulid", func() (interface{}, error) { return NewULID() })
+}
+
+// 注册主键生成器，在 _ 字段上使用 keygen:"name" 引用，同名的会被覆盖
+func Register(name string, generator Generator) {
+	generators.Store(name, generator)
+}
+
+func Get(name string) (Generator, bool) {
+	generator, ok := generators.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return generator.(Generator), true
+}
+
+// ---------------------- snowflake ----------------------
+
+// 41位毫秒时间戳 + 10位节点 + 12位序列号，时间戳从2020-01-01开始
+const (
+	snowflakeEpoch    = int64(1577836800000)
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = -1 ^ (-1 << snowflakeNodeBits)
+	snowflakeMaxSeq   = -1 ^ (-1 << snowflakeSeqBits)
+)
+
+var snowflake = struct {
+	sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+}{}
+
+// 设置snowflake的节点号，多实例部署时每个实例必须不同，范围为0-1023
+func SetSnowflakeNode(node int64) error {
+	if node < 0 || node > snowflakeMaxNode {
+		return fmt.Errorf("snowflake节点号必须在0-%d之间: %d", snowflakeMaxNode, node)
+	}
+	snowflake.Lock()
+	defer snowflake.Unlock()
+	snowflake.node = node
+	return nil
+}
+
+func NextSnowflake() (int64, error) {
+	snowflake.Lock()
+	defer snowflake.Unlock()
+	now := time.Now().UnixMilli()
+	if now < snowflake.lastTime {
+		return 0, fmt.Errorf("时钟回拨了 %d 毫秒，无法生成snowflake", snowflake.lastTime-now)
+	}
+	if now == snowflake.lastTime {
+		snowflake.sequence = (snowflake.sequence + 1) & snowflakeMaxSeq
+		// 同一毫秒内序列号用完，等待下一毫秒
+		if snowflake.sequence == 0 {
+			for now <= snowflake.lastTime {
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		snowflake.sequence = 0
+	}
+	snowflake.lastTime = now
+	return (now-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | snowflake.node<<snowflakeSeqBits | snowflake.sequence, nil
+}
+
+// ---------------------- uuid ----------------------
+
+// 随机生成的uuid v4，格式为 xxxxxxxx-xxxx-4xxx-xxxx-xxxxxxxxxxxx
+func NewUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// ---------------------- ulid ----------------------
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// 48位毫秒时间戳 + 80位随机数，使用Crockford base32编码为26个字符，按时间有序
+func NewULID() (string, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	if ms >= 1<<48 {
+		return "", errors.New("时间超出ulid的范围")
+	}
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	// 128位按5位一组编码，首字符只有3位
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
@@ -0,0 +1,120 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"vodka/analyzer"
+	"vodka/database"
+)
+
+// 聚合函数，如 sum(amount)、count(*)、count(distinct user_id)，可以用as指定别名
+var aggregateRegexp = regexp.MustCompile(`(?i)^\s*(count|sum|avg|max|min)\s*\(\s*(distinct\s+)?(\*|[A-Za-z_][A-Za-z0-9_]*)\s*\)\s*(?:as\s+([A-Za-z_][A-Za-z0-9_]*))?\s*$`)
+
+// 聚合查询的语句，条件与SelectAllByMap相同
+func buildAggregates(builder *strings.Builder, where string, scope string) {
+	for _, aggregate := range [][2]string{
+		{"Sum", "sum(${_column})"},
+		{"Max", "max(${_column})"},
+		{"Min", "min(${_column})"},
+		{"Avg", "avg(${_column})"},
+		{"CountDistinct", "count(distinct ${_column})"},
+	} {
+		builder.WriteString(fmt.Sprintf(`<select id="%s">select %s from %s <where> %s %s </where></select>`, aggregate[0], aggregate[1], tableParam, where, scope))
+	}
+	builder.WriteString(fmt.Sprintf(`<select id="GroupBy">select ${_select} from %s <where> %s %s </where> group by ${_group}</select>`, tableParam, where, scope))
+}
+
+// 聚合的列会直接拼接到sql中，执行前校验只能是实体中的列
+func checkAggregateColumn(function *analyzer.Function, tags []string) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		column, _ := params["_column"].(string)
+		if !containsString(tags, column) {
+			return fmt.Errorf("%s 不能聚合列 %s，只能是实体中的列", function.Id, column)
+		}
+		return execute(resultWrappers, params)
+	}
+}
+
+// GroupBy执行前校验分组的列和聚合函数，生成select和group by子句
+func bindGroupBy(function *analyzer.Function, tags []string) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		columns, _ := params["_columns"].([]string)
+		aggregates, _ := params["_aggregates"].([]string)
+		if len(columns) == 0 {
+			return errors.New("GroupBy 必须至少指定一个分组的列")
+		}
+		selects := make([]string, 0, len(columns)+len(aggregates))
+		for _, column := range columns {
+			if !containsString(tags, column) {
+				return fmt.Errorf("GroupBy 不能按列 %s 分组，只能是实体中的列", column)
+			}
+			selects = append(selects, column)
+		}
+		for _, aggregate := range aggregates {
+			expression, err := parseAggregate(aggregate, tags)
+			if err != nil {
+				return err
+			}
+			selects = append(selects, expression)
+		}
+		params["_select"] = strings.Join(selects, ",")
+		params["_group"] = strings.Join(columns, ",")
+		return execute(resultWrappers, params)
+	}
+}
+
+// 解析聚合函数，没有别名时使用 函数名_列名，如 sum(amount) as sum_amount，count(*) as count
+func parseAggregate(aggregate string, tags []string) (string, error) {
+	matches := aggregateRegexp.FindStringSubmatch(aggregate)
+	if matches == nil {
+		return "", fmt.Errorf("非法的聚合函数: %s", aggregate)
+	}
+	fn, distinct, column, alias := strings.ToLower(matches[1]), matches[2] != "", matches[3], matches[4]
+	if column == "*" {
+		if fn != "count" || distinct {
+			return "", fmt.Errorf("非法的聚合函数: %s", aggregate)
+		}
+	} else if !containsString(tags, column) {
+		return "", fmt.Errorf("不能聚合列 %s，只能是实体中的列", column)
+	}
+	if alias == "" {
+		alias = fn
+		if column != "*" {
+			alias += "_" + column
+		}
+	}
+	if distinct {
+		column = "distinct " + column
+	}
+	return fmt.Sprintf("%s(%s) as %s", fn, column, alias), nil
+}
+
+// 将GroupBy的结果按vo标签映射为DTO
+//
+//	reports, err := vodka.GroupByAs[Report](&orderMapper.VodkaMapper, []string{"user_id"}, []string{"sum(amount) as total"}, nil)
+func GroupByAs[DTO any, T any, ID any](m *VodkaMapper[T, ID], columns []string, aggregates []string, params map[string]interface{}) ([]*DTO, error) {
+	if m.GroupBy == nil {
+		return nil, errors.New("mapper未初始化")
+	}
+	rows, err := m.GroupBy(columns, aggregates, params)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*DTO, 0, len(rows))
+	for _, row := range rows {
+		dto := new(DTO)
+		if err := database.ScanStruct(row, reflect.ValueOf(dto).Elem()); err != nil {
+			return nil, err
+		}
+		result = append(result, dto)
+	}
+	if err := AfterQuery([]interface{}{&result}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
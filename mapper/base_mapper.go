@@ -7,21 +7,52 @@ import (
 	"reflect"
 	"strings"
 	"vodka/analyzer"
+	"vodka/database"
+	"vodka/util"
 )
 
 type VodkaMapper[T any, ID any] struct {
 	InsertOne            func(params *T) (int64, int64, error)                                                      `params:"params"`
 	InsertBatch          func(params []*T) (int64, int64, error)                                                    `params:"params"`
+	InsertIgnore         func(params *T) (int64, int64, error)                                                      `params:"params"`
+	Upsert               func(params *T) (int64, int64, error)                                                      `params:"params"`
+	UpsertBatch          func(params []*T) (int64, int64, error)                                                    `params:"params"`
 	UpdateById           func(params *T) (int64, error)                                                             `params:"params"`
 	UpdateSelectiveById  func(params *T) (int64, error)                                                             `params:"params"`
+	UpdateFieldsById     func(params *T, fields ...string) (int64, error)                                           `params:"...params,_fields"`
 	UpdateByCondition    func(condition *T, action *T) (int64, error)                                               `params:"condition,action"`
 	UpdateByConditionMap func(condition map[string]interface{}, action map[string]interface{}) (int64, error)       `params:"condition,action"`
 	DeleteById           func(id ID) (int64, error)                                                                 `params:"id"`
+	DeleteByIds          func(ids []ID) (int64, error)                                                              `params:"ids"`
+	DeleteByCondition    func(condition *T) (int64, error)                                                          `params:"condition"`
+	DeleteByConditionMap func(condition map[string]interface{}) (int64, error)                                      `params:"condition"`
 	SelectById           func(id ID) (*T, error)                                                                    `params:"id"`
+	SelectByIds          func(ids []ID) ([]*T, error)                                                               `params:"ids"`
+	ExistsById           func(id ID) (bool, error)                                                                  `params:"id"`
+	SelectOne            func(params *T) (*T, error)                                                                `params:"params"`
+	SelectOneByMap       func(params map[string]interface{}) (*T, error)                                            `params:"params"`
 	SelectAll            func(params *T, order string, offset int64, limit int64) ([]*T, error)                     `params:"...params,order,offset,limit"`
 	CountAll             func(params *T) (int64, error)                                                             `params:"params"`
 	SelectAllByMap       func(params map[string]interface{}, order string, offset int64, limit int64) ([]*T, error) `params:"...params,order,offset,limit"`
 	CountAllByMap        func(params map[string]interface{}) (int64, error)                                         `params:"params"`
+
+	// 聚合查询，条件与SelectAllByMap相同
+	Sum           func(column string, params map[string]interface{}) (float64, error)                                          `params:"_column,...params"`
+	Max           func(column string, params map[string]interface{}) (interface{}, error)                                      `params:"_column,...params"`
+	Min           func(column string, params map[string]interface{}) (interface{}, error)                                      `params:"_column,...params"`
+	Avg           func(column string, params map[string]interface{}) (float64, error)                                          `params:"_column,...params"`
+	CountDistinct func(column string, params map[string]interface{}) (int64, error)                                            `params:"_column,...params"`
+	GroupBy       func(columns []string, aggregates []string, params map[string]interface{}) ([]map[string]interface{}, error) `params:"_columns,_aggregates,...params"`
+
+	// 只查询指定的列，条件、排序和分页与SelectAllByMap相同
+	SelectColumnsByMap func(columns []string, params map[string]interface{}, order string, offset int64, limit int64) ([]map[string]interface{}, error) `params:"_columns,...params,order,offset,limit"`
+
+	// 悲观锁查询，必须在事务中调用，默认for update，可以指定database.ForShare、database.ForUpdateSkipLocked等
+	// SelectAllForUpdate的条件和排序与SelectAllByMap相同，limit为0时不限制行数
+	SelectByIdForUpdate func(id ID, lock ...database.Lock) (*T, error)                                                      `params:"id,_locks"`
+	SelectAllForUpdate  func(params map[string]interface{}, order string, limit int64, lock ...database.Lock) ([]*T, error) `params:"...params,order,limit,_locks"`
+
+	metadata *MetaData
 }
 
 type Tag struct {
@@ -38,8 +69,9 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 		return nil, errors.New("没有分析出 _ 字段附加的表信息，无法使用BaseMapper")
 	}
 	if len(metadata.PKNames) == 0 {
-		return nil, errors.New("没有分析出 _ 字段附加的表信息，无法使用BaseMapper")
+		return nil, errors.New("没有声明pk，无法使用BaseMapper")
 	}
+	m.metadata = metadata
 	// 反射T类型
 	baseMapperType := reflect.TypeOf(m).Elem()
 	log.Println("Mapper类型", baseMapperType)
@@ -54,6 +86,7 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 	// 获取T的类型（去掉指针）
 	tType := tPtrType.Elem()
 	log.Println("T的类型:", tType)
+	registerEntity(tType, metadata)
 
 	// 获取tType中的空字段
 	// 获取tType中的_字段
@@ -78,7 +111,7 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 		// 		}
 		// 	}
 		// } else {
-		if voTag := field.Tag.Get("vo"); voTag != "" {
+		if voTag := util.VoName(field.Tag.Get("vo")); voTag != "" && voTag != "-" {
 			tags = append(tags, voTag)
 			fields = append(fields, field)
 		}
@@ -86,30 +119,95 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 
 	}
 
+	logicDelete, err := parseLogicDelete(fields)
+	if err != nil {
+		return nil, err
+	}
+	metadata.LogicDelete = logicDelete
+	versionLock, err := parseVersionLock(fields)
+	if err != nil {
+		return nil, err
+	}
+	metadata.VersionLock = versionLock
+	fillFields, err := parseFillFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	metadata.FillFields = fillFields
+	keyGenerator, err := parseKeyGenerator(metadata.KeyGen, metadata.PKs, fields, tags)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Columns, err = parseColumnOptions(fields, metadata.PKs); err != nil {
+		return nil, err
+	}
+	checks, err := parseChecks(fields)
+	if err != nil {
+		return nil, err
+	}
+	metadata.checks = checks
+	if err := checkEntityMask(tType); err != nil {
+		return nil, err
+	}
+	// 逻辑删除的过滤条件，没有逻辑删除列时为空
+	scope := logicDelete.filter()
+
+	// 所有主键都必须是实体中的列
+	for _, pk := range metadata.PKs {
+		if !containsString(tags, pk) {
+			return nil, fmt.Errorf("主键 %s 在 %s 中没有对应的vo标签", pk, tType)
+		}
+	}
+	// ID参数中各个主键的取值表达式
+	deleteByIdField, _ := baseMapperType.FieldByName("DeleteById")
+	idType := deleteByIdField.Type.In(0)
+	idValues, err := pkExpressions(idType, metadata.PKs, "id", true)
+	if err != nil {
+		return nil, err
+	}
+	itemValues, err := pkExpressions(idType, metadata.PKs, "item", false)
+	if err != nil {
+		return nil, err
+	}
+	// 加锁查询还有_locks参数，id不会被展开，按 id.主键 取值
+	lockedIdValues, err := pkExpressions(idType, metadata.PKs, "id", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 单一的整数主键为0且没有主键生成器时使用自增
+	autoIncrement := len(metadata.PKs) == 1 && keyGenerator == nil && isIntegerKind(fields[indexOf(tags, metadata.PKs[0])].Type.Kind())
+	// 查询时明确列出实体中的列，表中新增的列不会影响已有的实体
+	metadata.Tags = tags
+	selectColumns := strings.Join(tags, ",")
 	// 拼装sql
-	var insertOneBuilder strings.Builder
-	insertOneBuilder.WriteString("<insert id=\"InsertOne\">insert into " + metadata.TableName + " (")
-	var insertBatchBuilder strings.Builder
-	insertBatchBuilder.WriteString("<insert id=\"InsertBatch\">insert into " + metadata.TableName + " (")
+	insertOne, insertBatch := buildInsert(metadata, fields, tags, autoIncrement)
 	var updateByIdBuilder strings.Builder
-	updateByIdBuilder.WriteString("<update id=\"UpdateById\">update " + metadata.TableName + " <set>")
+	updateByIdBuilder.WriteString("<update id=\"UpdateById\">update " + tableParam + " <set>" + versionLock.increment())
 	var updateSelectiveByIdBuilder strings.Builder
-	updateSelectiveByIdBuilder.WriteString("<update id=\"UpdateSelectiveById\">update " + metadata.TableName + " <set>")
+	updateSelectiveByIdBuilder.WriteString("<update id=\"UpdateSelectiveById\">update " + tableParam + " <set>" + versionLock.increment())
+	// 只更新指定的列，_fields为列名
+	var updateFieldsByIdBuilder strings.Builder
+	updateFieldsByIdBuilder.WriteString("<update id=\"UpdateFieldsById\">update " + tableParam + " <set>" + versionLock.increment())
 	var deleteByIdBuilder strings.Builder
-	deleteByIdBuilder.WriteString("<delete id=\"DeleteById\">delete from " + metadata.TableName + " <where> ")
+	deleteByIdBuilder.WriteString("<delete id=\"DeleteById\">" + logicDelete.deleteFrom(tableParam) + " <where> ")
 	var selectByIdBuilder strings.Builder
-	selectByIdBuilder.WriteString("<select id=\"SelectById\">select * from " + metadata.TableName + " <where> ")
+	selectByIdBuilder.WriteString("<select id=\"SelectById\">select " + selectColumns + " from " + tableParam + " <where> ")
+	var selectByIdForUpdateBuilder strings.Builder
+	selectByIdForUpdateBuilder.WriteString("<select id=\"SelectByIdForUpdate\" lock=\"update\">select " + selectColumns + " from " + tableParam + " <where> ")
+	var existsByIdBuilder strings.Builder
+	existsByIdBuilder.WriteString("<select id=\"ExistsById\">select 1 from " + tableParam + " <where> ")
 	var selectAllBuilder strings.Builder
 	var selectAllWhereBuilder strings.Builder
-	selectAllBuilder.WriteString("<select id=\"SelectAll\">select * from " + metadata.TableName + " <where> ")
+	selectAllBuilder.WriteString("<select id=\"SelectAll\">select " + selectColumns + " from " + tableParam + " <where> ")
 	var selectAllByMapBuilder strings.Builder
-	selectAllByMapBuilder.WriteString("<select id=\"SelectAllByMap\">select * from " + metadata.TableName + " <where> ")
+	selectAllByMapBuilder.WriteString("<select id=\"SelectAllByMap\">select " + selectColumns + " from " + tableParam + " <where> ")
 	var selectAllByMapWhereBuilder strings.Builder
 	// update的condition
 	var updateByConditionBuilder strings.Builder
-	updateByConditionBuilder.WriteString(`<update id="UpdateByCondition">update ` + metadata.TableName + ` <set> `)
+	updateByConditionBuilder.WriteString(`<update id="UpdateByCondition">update ` + tableParam + ` <set> ` + versionLock.increment())
 	var updateByConditionMapBuilder strings.Builder
-	updateByConditionMapBuilder.WriteString(`<update id="UpdateByConditionMap">update ` + metadata.TableName + ` <set> `)
+	updateByConditionMapBuilder.WriteString(`<update id="UpdateByConditionMap">update ` + tableParam + ` <set> ` + versionLock.increment())
 	//var selectAllBuilder strings.Builder
 	//var selectAllByMapBuilder strings.Builder
 
@@ -121,8 +219,6 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 		// fieldTag := field.Tag
 		// fieldValue := field.Value
 		// 只处理有tag的
-		insertOneBuilder.WriteString(tags[i])
-		insertBatchBuilder.WriteString(tags[i])
 		isNumberType := fields[i].Type.Kind() == reflect.Int || fields[i].Type.Kind() == reflect.Int64 || fields[i].Type.Kind() == reflect.Float64
 		isNumberTypeArr[i] = isNumberType
 		isStringType := fields[i].Type.Kind() == reflect.String
@@ -130,15 +226,20 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 		// 如果是主键
 		if _, ok := metadata.PKNames[tags[i]]; ok {
 			// updateByIdBuilder.WriteString(tags[i] + " = #{" + tags[i] + "}")
-			selectByIdBuilder.WriteString(" and " + tags[i] + " = #{" + tags[i] + "}")
-			deleteByIdBuilder.WriteString(" and " + tags[i] + " = #{" + tags[i] + "}")
+		} else if logicDelete != nil && tags[i] == logicDelete.Column {
+			// 逻辑删除列只能通过删除方法修改
+		} else if versionLock != nil && tags[i] == versionLock.Column {
+			// 版本号列在更新时自增
+		} else if metadata.IsInsertOnly(tags[i]) || metadata.IsReadOnly(tags[i]) {
+			// 只在插入时写入的列和只读的列不会被更新
 		} else {
 			updateByIdBuilder.WriteString(tags[i] + " = #{" + tags[i] + "},")
 			// 处理selective的类型，如果是int int64 float64 这些，不能判断==null
-			updateSelectiveByIdBuilder.WriteString(fmt.Sprintf(`<if test="%s != 0 && %s != null && %s != ''">%s = #{%s},</if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
-			updateSetStatement := fmt.Sprintf(`<if test="action.%s != 0 && action.%s != null && action.%s != ''">%s = #{action.%s},</if>`, tags[i], tags[i], tags[i], tags[i], tags[i])
-			updateByConditionBuilder.WriteString(updateSetStatement)
-			updateByConditionMapBuilder.WriteString(updateSetStatement)
+			updateSelectiveByIdBuilder.WriteString(fmt.Sprintf(`<if test="%s">%s = #{%s},</if>`, presenceTest(tags[i], fields[i]), tags[i], tags[i]))
+			updateByConditionBuilder.WriteString(fmt.Sprintf(`<if test="%s">%s = #{action.%s},</if>`, presenceTest("action."+tags[i], fields[i]), tags[i], tags[i]))
+			// map中出现的key都会更新，值为nil时更新为NULL
+			updateByConditionMapBuilder.WriteString(fmt.Sprintf(`<if test="_has(action, '%s')">%s = #{action.%s},</if>`, tags[i], tags[i], tags[i]))
+			updateFieldsByIdBuilder.WriteString(fmt.Sprintf(`<if test="_contains(_fields, '%s')">%s = #{%s},</if>`, tags[i], tags[i], tags[i]))
 			// if isNumberType {
 			// } else if(is{
 			// 	updateSelectiveByIdBuilder.WriteString(fmt.Sprintf(`<if test="%s != null">%s = #{%s},</if>`, tags[i], tags[i], tags[i]))
@@ -148,9 +249,9 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 			// }
 		}
 		// 查询条件
-		selectAllWhereBuilder.WriteString(fmt.Sprintf(` <if test="%s != null && %s != '' && %s != 0"> and %s = #{%s} </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
+		selectAllWhereBuilder.WriteString(fmt.Sprintf(` <if test="%s"> and %s = #{%s} </if>`, presenceTest(tags[i], fields[i]), tags[i], tags[i]))
 		// 针对map的查询条件
-		buildMapCondition(&selectAllByMapWhereBuilder, tags[i], tags[i])
+		buildMapCondition(&selectAllByMapWhereBuilder, "", tags[i])
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="EQ_%s != null && EQ_%s != '' && EQ_%s != 0"> and %s = #{%s} </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="GT_%s != null && GT_%s != '' && GT_%s != 0"> and %s > #{%s} </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="LT_%s != null && LT_%s != '' && LT_%s != 0"> and %s < #{%s} </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
@@ -158,85 +259,393 @@ func (m *VodkaMapper[T, ID]) BuildTags(metadata *MetaData) ([]*analyzer.Function
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="LTE_%s != null && LTE_%s != '' && LTE_%s != 0"> and %s <= #{%s} </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="LIKE_%s != null && LIKE_%s != '' && LIKE_%s != 0"> and %s like concat('%%',#{%s},'%%') </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
 		// selectAllByMapWhereBuilder.WriteString(fmt.Sprintf(` <if test="IN_%s != null && IN_%s != '' && IN_%s != 0"> and %s in <foreach collection='%s' item='item' separator=',' open='(' close=')'>#{item}</foreach> </if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
-		if i != len(fields)-1 {
-			insertOneBuilder.WriteString(",")
-			insertBatchBuilder.WriteString(",")
-		}
 	}
-	insertOneBuilder.WriteString(") values (")
-	insertBatchBuilder.WriteString(") values <foreach collection='params' item='item' separator=','>(")
+	buildOrGroup(&selectAllByMapWhereBuilder, "", tags)
 	updateByIdBuilder.WriteString("</set> <where>")
 	updateSelectiveByIdBuilder.WriteString("</set> <where>")
+	updateFieldsByIdBuilder.WriteString("</set> <where>")
 	updateByConditionBuilder.WriteString("</set> <where>")
 	updateByConditionMapBuilder.WriteString("</set> <where>")
 	// 处理值
 	for i := 0; i < len(fields); i++ {
 		// 如果是主键
-		if _, ok := metadata.PKNames[tags[i]]; ok && (fields[i].Type.Kind() == reflect.Int64) {
-			insertOneBuilder.WriteString("#{" + tags[i] + " == 0 ? $AUTO : " + tags[i] + "}")
-			insertBatchBuilder.WriteString("#{item." + tags[i] + " == 0 ? $AUTO : item." + tags[i] + "}")
+		if _, ok := metadata.PKNames[tags[i]]; ok {
 			updateByIdBuilder.WriteString(" and " + tags[i] + " = #{" + tags[i] + "}")
 			updateSelectiveByIdBuilder.WriteString(fmt.Sprintf(" and %s = #{%s}", tags[i], tags[i]))
-		} else {
-			insertOneBuilder.WriteString("#{" + tags[i] + "}")
-			insertBatchBuilder.WriteString("#{item." + tags[i] + "}")
+			updateFieldsByIdBuilder.WriteString(fmt.Sprintf(" and %s = #{%s}", tags[i], tags[i]))
 		}
 		// 更新语句
-		updateByConditionBuilder.WriteString(fmt.Sprintf(`<if test="condition.%s != 0 && condition.%s != null && condition.%s != ''"> and %s = #{condition.%s}</if>`, tags[i], tags[i], tags[i], tags[i], tags[i]))
-		buildMapCondition(&updateByConditionMapBuilder, "condition."+tags[i], tags[i])
-		if i != len(fields)-1 {
-			insertOneBuilder.WriteString(",")
-			insertBatchBuilder.WriteString(",")
-		}
-	}
-	insertOneBuilder.WriteString(")</insert>")
-	insertBatchBuilder.WriteString(")</foreach></insert>")
-	updateByIdBuilder.WriteString("</where></update>")
-	updateSelectiveByIdBuilder.WriteString("</where></update>")
-	deleteByIdBuilder.WriteString("</where></delete>")
-	selectByIdBuilder.WriteString("</where></select>")
+		updateByConditionBuilder.WriteString(fmt.Sprintf(`<if test="%s"> and %s = #{condition.%s}</if>`, presenceTest("condition."+tags[i], fields[i]), tags[i], tags[i]))
+		buildMapCondition(&updateByConditionMapBuilder, "condition.", tags[i])
+	}
+	buildOrGroup(&updateByConditionMapBuilder, "condition.", tags)
+	updateByIdBuilder.WriteString(versionLock.condition() + scope + "</where></update>")
+	updateSelectiveByIdBuilder.WriteString(versionLock.condition() + scope + "</where></update>")
+	updateFieldsByIdBuilder.WriteString(versionLock.condition() + scope + "</where></update>")
+	for i, pk := range metadata.PKs {
+		condition := fmt.Sprintf(" and %s = #{%s}", pk, idValues[i])
+		deleteByIdBuilder.WriteString(condition)
+		selectByIdBuilder.WriteString(condition)
+		existsByIdBuilder.WriteString(condition)
+		selectByIdForUpdateBuilder.WriteString(fmt.Sprintf(" and %s = #{%s}", pk, lockedIdValues[i]))
+	}
+	selectByIdForUpdateBuilder.WriteString(scope + "</where></select>")
+	deleteByIdBuilder.WriteString(scope + "</where></delete>")
+	selectByIdBuilder.WriteString(scope + "</where></select>")
+	existsByIdBuilder.WriteString(scope + "</where> limit 1</select>")
 	selectAllBuilder.WriteString(selectAllWhereBuilder.String())
-	selectAllBuilder.WriteString(`</where> <if test="order != ''"> order by ${order} </if> limit #{offset},#{limit}</select>`)
+	selectAllBuilder.WriteString(scope + `</where> <if test="order != ''"> order by ${order} </if> limit #{offset},#{limit}</select>`)
 	selectAllByMapBuilder.WriteString(selectAllByMapWhereBuilder.String())
-	selectAllByMapBuilder.WriteString(`</where> <if test="order != ''"> order by ${order} </if> limit #{offset},#{limit}</select>`)
-	updateByConditionBuilder.WriteString("</where></update>")
-	updateByConditionMapBuilder.WriteString("</where></update>")
+	selectAllByMapBuilder.WriteString(scope + `</where> <if test="order != ''"> order by ${order} </if> limit #{offset},#{limit}</select>`)
+	updateByConditionBuilder.WriteString(scope + "</where></update>")
+	updateByConditionMapBuilder.WriteString(scope + "</where></update>")
 
 	// 针对map类参数的处理
 	var builder strings.Builder
 	builder.WriteString("<mapper>")
-	builder.WriteString(insertOneBuilder.String())
-	builder.WriteString(insertBatchBuilder.String())
+	// 自增主键插入后写回实体
+	keyProperty := ""
+	if autoIncrement {
+		keyProperty = fmt.Sprintf(` keyProperty="%s"`, metadata.PKs[0])
+	}
+	builder.WriteString(`<insert id="InsertOne"` + keyProperty + `>` + insertOne + `</insert>`)
+	builder.WriteString(`<insert id="InsertBatch"` + keyProperty + `>` + insertBatch + `</insert>`)
+	// 冲突时更新或忽略的语句，根据方言生成
+	dialect := database.GetDialect()
+	upsertClause := dialect.UpsertClause(metadata.UniqueKeys, upsertColumns(tags, metadata))
+	builder.WriteString(`<insert id="Upsert">` + insertOne + upsertClause + `</insert>`)
+	builder.WriteString(`<insert id="UpsertBatch">` + insertBatch + upsertClause + `</insert>`)
+	builder.WriteString(`<insert id="InsertIgnore">` + dialect.InsertIgnore(insertOne) + `</insert>`)
 	builder.WriteString(updateByIdBuilder.String())
 	builder.WriteString(updateSelectiveByIdBuilder.String())
+	builder.WriteString(updateFieldsByIdBuilder.String())
 	builder.WriteString(deleteByIdBuilder.String())
 	builder.WriteString(selectByIdBuilder.String())
+	builder.WriteString(selectByIdForUpdateBuilder.String())
 	builder.WriteString(selectAllBuilder.String())
-	builder.WriteString(fmt.Sprintf(`<select id="CountAll">select count(*) from %s <where> %s </where></select>`, metadata.TableName, selectAllWhereBuilder.String()))
+	builder.WriteString(fmt.Sprintf(`<select id="CountAll">select count(*) from %s <where> %s %s </where></select>`, tableParam, selectAllWhereBuilder.String(), scope))
 	builder.WriteString(selectAllByMapBuilder.String())
-	builder.WriteString(fmt.Sprintf(`<select id="CountAllByMap">select count(*) from %s <where> %s </where></select>`, metadata.TableName, selectAllByMapWhereBuilder.String()))
+	builder.WriteString(fmt.Sprintf(`<select id="CountAllByMap">select count(*) from %s <where> %s %s </where></select>`, tableParam, selectAllByMapWhereBuilder.String(), scope))
 	builder.WriteString(updateByConditionBuilder.String())
 	builder.WriteString(updateByConditionMapBuilder.String())
+	// 按id集合查询、删除
+	idsCondition := buildIdsCondition(metadata.PKs, itemValues)
+	builder.WriteString(fmt.Sprintf(`<select id="SelectByIds">select %s from %s where %s%s</select>`, selectColumns, tableParam, idsCondition, scope))
+	builder.WriteString(fmt.Sprintf(`<delete id="DeleteByIds">%s where %s%s</delete>`, logicDelete.deleteFrom(tableParam), idsCondition, scope))
+	builder.WriteString(existsByIdBuilder.String())
+	// 按条件删除时必须至少有一个条件，防止删除整张表
+	// 逻辑删除的过滤条件放在where外面，不计入required的条件
+	builder.WriteString(fmt.Sprintf(`<delete id="DeleteByCondition">%s <where required="true"> %s </where>%s</delete>`, logicDelete.deleteFrom(tableParam), selectAllWhereBuilder.String(), scope))
+	builder.WriteString(fmt.Sprintf(`<delete id="DeleteByConditionMap">%s <where required="true"> %s </where>%s</delete>`, logicDelete.deleteFrom(tableParam), selectAllByMapWhereBuilder.String(), scope))
+	builder.WriteString(fmt.Sprintf(`<select id="SelectOne">select %s from %s <where> %s %s </where> limit 1</select>`, selectColumns, tableParam, selectAllWhereBuilder.String(), scope))
+	builder.WriteString(fmt.Sprintf(`<select id="SelectOneByMap">select %s from %s <where> %s %s </where> limit 1</select>`, selectColumns, tableParam, selectAllByMapWhereBuilder.String(), scope))
+	builder.WriteString(fmt.Sprintf(`<select id="SelectAllForUpdate" lock="update">select %s from %s <where> %s %s </where> <if test="order != ''"> order by ${order} </if> <if test="limit > 0"> limit #{limit} </if></select>`, selectColumns, tableParam, selectAllByMapWhereBuilder.String(), scope))
+	buildAggregates(&builder, selectAllByMapWhereBuilder.String(), scope)
+	builder.WriteString(fmt.Sprintf(`<select id="SelectColumnsByMap">select ${_select} from %s <where> %s %s </where> <if test="order != ''"> order by ${order} </if> limit #{offset},#{limit}</select>`, tableParam, selectAllByMapWhereBuilder.String(), scope))
 	builder.WriteString("</mapper>")
 
-	return analyzer.ParseXml(metadata.Namespace, builder.String())
+	functions, err := analyzer.ParseXml(metadata.Namespace, builder.String())
+	if err != nil {
+		return nil, err
+	}
+	functionMap := make(map[string]*analyzer.Function, len(functions))
+	for _, function := range functions {
+		functionMap[function.Id] = function
+	}
+	// 写入前的校验在自动填充之后执行，被填充的值同样需要通过校验，不写入的列为零值时不校验
+	if len(checks) > 0 {
+		for _, id := range []string{"InsertOne", "InsertBatch", "InsertIgnore", "Upsert", "UpsertBatch"} {
+			bindCheck(functionMap[id], checks, metadata.TableName, func(column string) bool {
+				return metadata.IsOmitEmpty(column) || metadata.IsReadOnly(column)
+			})
+		}
+		bindCheck(functionMap["UpdateById"], checks, metadata.TableName, func(column string) bool {
+			return metadata.IsInsertOnly(column) || metadata.IsReadOnly(column)
+		})
+		bindCheck(functionMap["UpdateSelectiveById"], checks, metadata.TableName, func(string) bool { return true })
+	}
+	// 自动填充在校验之外，先校验UpdateFieldsById的列，再追加被填充的列
+	if len(fillFields) > 0 {
+		for _, id := range []string{"InsertOne", "InsertBatch", "InsertIgnore", "Upsert", "UpsertBatch"} {
+			bindFill(functionMap[id], fillFields, FillInsert)
+		}
+		for _, id := range []string{"UpdateById", "UpdateSelectiveById", "UpdateFieldsById"} {
+			bindFill(functionMap[id], fillFields, FillUpdate)
+		}
+	}
+	if keyGenerator != nil {
+		for _, id := range []string{"InsertOne", "InsertBatch", "InsertIgnore", "Upsert", "UpsertBatch"} {
+			keyGenerator.bind(functionMap[id])
+		}
+	}
+	checkUpdateFields(functionMap["UpdateFieldsById"], tags, metadata)
+	for _, id := range []string{"Sum", "Max", "Min", "Avg", "CountDistinct"} {
+		checkAggregateColumn(functionMap[id], tags)
+	}
+	bindGroupBy(functionMap["GroupBy"], tags)
+	bindSelectColumns(functionMap["SelectColumnsByMap"], tags)
+	for _, id := range []string{"SelectByIdForUpdate", "SelectAllForUpdate"} {
+		bindLock(functionMap[id])
+	}
+	if versionLock != nil {
+		for _, id := range []string{"UpdateById", "UpdateSelectiveById", "UpdateFieldsById"} {
+			versionLock.bind(functionMap[id], metadata.TableName)
+		}
+	}
+	if logicDelete != nil {
+		for _, function := range functions {
+			bindUnscoped(function)
+		}
+	}
+	for _, function := range functions {
+		if len(metadata.Columns.Encrypt) > 0 {
+			bindEncrypt(function, metadata.Columns.Encrypt)
+		}
+		bindTable(function, metadata)
+	}
+	return functions, nil
 	// return resultMap, nil
 }
 
-// 构造conditionMap
-func buildMapCondition(builder *strings.Builder, action, condition string) {
-	builder.WriteString(fmt.Sprintf(` <if test="EQ_%s != null && EQ_%s != '' && EQ_%s != 0"> and %s = #{EQ_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="NE_%s != null && NE_%s != '' && NE_%s != 0"> and %s <> #{NE_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="GT_%s != null && GT_%s != '' && GT_%s != 0"> and %s > #{GT_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="LT_%s != null && LT_%s != '' && LT_%s != 0"> and %s < #{LT_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="GTE_%s != null && GTE_%s != '' && GTE_%s != 0"> and %s >= #{GTE_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="LTE_%s != null && LTE_%s != '' && LTE_%s != 0"> and %s <= #{LTE_%s} </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="LIKE_%s != null && LIKE_%s != '' && LIKE_%s != 0"> and %s like concat('%%',#{LIKE_%s},'%%') </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="IN_%s != null && IN_%s != '' && IN_%s != 0"> and %s in <foreach collection='IN_%s' item='item' separator=',' open='(' close=')'>#{item}</foreach> </if>`, condition, condition, condition, condition, condition))
-	builder.WriteString(fmt.Sprintf(` <if test="NOT_IN_%s != null && NOT_IN_%s != '' && NOT_IN_%s != 0"> and %s not in <foreach collection='NOT_IN_%s' item='item' separator=',' open='(' close=')'>#{item}</foreach> </if>`, condition, condition, condition, condition, condition))
-	// 暂时不要between
-	// builder.WriteString(fmt.Sprintf(` <if test="BETWEEN_%s != null && BETWEEN_%s != '' && BETWEEN_%s != 0"> and %s between #{%s} and #{%s} </if>`, condition, condition, condition, condition, condition, condition))
-	// builder.WriteString(fmt.Sprintf(` <if test="NOT_BETWEEN_%s != null && NOT_BETWEEN_%s != '' && NOT_BETWEEN_%s != 0"> and %s not between #{%s} and #{%s} </if>`, condition, condition, condition, condition, condition, condition))
+// UpdateFieldsById执行前校验_fields，必须至少指定一列，只能是实体中的非主键列，逻辑删除列、版本号列和只在插入时填充的列也不能更新
+func checkUpdateFields(function *analyzer.Function, tags []string, metadata *MetaData) {
+	columns := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if _, ok := metadata.PKNames[tag]; ok {
+			continue
+		}
+		if metadata.LogicDelete != nil && tag == metadata.LogicDelete.Column {
+			continue
+		}
+		if metadata.VersionLock != nil && tag == metadata.VersionLock.Column {
+			continue
+		}
+		if metadata.IsInsertOnly(tag) || metadata.IsReadOnly(tag) {
+			continue
+		}
+		columns[tag] = true
+	}
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		fields, _ := params["_fields"].([]string)
+		if len(fields) == 0 {
+			return errors.New("UpdateFieldsById 必须至少指定一列")
+		}
+		for _, field := range fields {
+			if !columns[field] {
+				return fmt.Errorf("UpdateFieldsById 不能更新列 %s，只能更新实体中的非主键列", field)
+			}
+		}
+		return execute(resultWrappers, params)
+	}
+}
+
+// 主键在ids中的条件，values为每个主键在元素item中的取值表达式
+// 联合主键时生成 (a = ? and b = ?) or (a = ? and b = ?)，ids为空时不匹配任何行
+func buildIdsCondition(pks []string, values []string) string {
+	var builder strings.Builder
+	builder.WriteString(`<if test="_len(ids) == 0"> 1 = 0 </if><if test="_len(ids) > 0">`)
+	if len(pks) == 1 {
+		builder.WriteString(pks[0] + ` in <foreach collection='ids' item='item' separator=',' open='(' close=')'>#{` + values[0] + `}</foreach>`)
+	} else {
+		conditions := make([]string, len(pks))
+		for i, pk := range pks {
+			conditions[i] = pk + " = #{" + values[i] + "}"
+		}
+		builder.WriteString(`<foreach collection='ids' item='item' separator=' or ' open='(' close=')'>(` + strings.Join(conditions, " and ") + `)</foreach>`)
+	}
+	builder.WriteString("</if>")
+	return builder.String()
+}
+
+// 主键在ID参数中的取值表达式，顺序和pks一致
+// ID为结构体或map时按主键名取值，为切片时按主键声明的顺序取值，其他类型只能用于单一主键
+// 联合主键的ID不能是interface{}，运行时的值可能是结构体也可能是切片，无法确定取值方式
+// expanded表示参数是方法的唯一参数，结构体和map会被展开，直接使用主键名取值
+func pkExpressions(idType reflect.Type, pks []string, param string, expanded bool) ([]string, error) {
+	kind := idType.Kind()
+	if kind == reflect.Ptr {
+		kind = idType.Elem().Kind()
+	}
+	values := make([]string, len(pks))
+	switch {
+	case kind == reflect.Struct || kind == reflect.Map:
+		for i, pk := range pks {
+			if expanded {
+				values[i] = pk
+			} else {
+				values[i] = param + "." + pk
+			}
+		}
+	case (kind == reflect.Slice && idType.Elem().Kind() != reflect.Uint8) || kind == reflect.Array:
+		for i := range pks {
+			values[i] = fmt.Sprintf("%s.%d", param, i)
+		}
+	case len(pks) == 1:
+		values[0] = param
+	default:
+		return nil, fmt.Errorf("联合主键 %s 的ID类型必须是结构体、map或切片，当前为 %s", strings.Join(pks, ","), idType)
+	}
+	return values, nil
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断结构体字段是否有值的表达式
+// 指针字段为nil时表示没有值，其他字段为零值或空字符串时表示没有值
+func presenceTest(key string, field reflect.StructField) string {
+	if field.Type.Kind() == reflect.Ptr {
+		return key + " != null"
+	}
+	return fmt.Sprintf("%[1]s != 0 && %[1]s != null && %[1]s != ''", key)
+}
+
+// 冲突时需要更新的列，主键、唯一键和只在插入时填充的列不更新
+// 生成单条插入和批量插入的语句，只读的列不写入，逻辑删除列写入未删除的值
+// omitempty的列为零值时，单条插入不写入该列，批量插入的每一行列必须相同，写入DEFAULT
+func buildInsert(metadata *MetaData, fields []reflect.StructField, tags []string, autoIncrement bool) (string, string) {
+	var columns, values, batchValues []string
+	// 有可以省略的列时，单条插入的每一项都以逗号结尾，由trim去掉最后一个逗号
+	var dynamicColumns, dynamicValues strings.Builder
+	dynamic := false
+	for i, tag := range tags {
+		if metadata.IsReadOnly(tag) {
+			continue
+		}
+		value, batchValue := "#{"+tag+"}", "#{item."+tag+"}"
+		if _, ok := metadata.PKNames[tag]; ok && autoIncrement {
+			value = "#{" + tag + " == 0 ? $AUTO : " + tag + "}"
+			batchValue = "#{item." + tag + " == 0 ? $AUTO : item." + tag + "}"
+		}
+		if logicDelete := metadata.LogicDelete; logicDelete != nil && tag == logicDelete.Column {
+			// 新插入的数据总是未删除的
+			value = logicDelete.insertValue()
+			batchValue = value
+			dynamicColumns.WriteString(tag + ",")
+			dynamicValues.WriteString(value + ",")
+		} else if metadata.IsOmitEmpty(tag) {
+			test := omitEmptyTest(tag, fields[i])
+			dynamicColumns.WriteString(fmt.Sprintf(`<if test="%s">%s,</if>`, test, tag))
+			dynamicValues.WriteString(fmt.Sprintf(`<if test="%s">%s,</if>`, test, value))
+			batchValue = fmt.Sprintf("#{%s ? item.%s : $AUTO}", omitEmptyTest("item."+tag, fields[i]), tag)
+			dynamic = true
+		} else {
+			dynamicColumns.WriteString(tag + ",")
+			dynamicValues.WriteString(value + ",")
+		}
+		columns = append(columns, tag)
+		values = append(values, value)
+		batchValues = append(batchValues, batchValue)
+	}
+	prefix := "insert into " + tableParam + " "
+	insertBatch := prefix + "(" + strings.Join(columns, ",") + ") values <foreach collection='params' item='item' separator=','>(" + strings.Join(batchValues, ",") + ")</foreach>"
+	if !dynamic {
+		return prefix + "(" + strings.Join(columns, ",") + ") values (" + strings.Join(values, ",") + ")", insertBatch
+	}
+	trim := `<trim prefix="(" suffix=")" suffixOverrides=",">`
+	return prefix + trim + dynamicColumns.String() + "</trim> values " + trim + dynamicValues.String() + "</trim>", insertBatch
+}
+
+// omitempty的列是否需要写入，指针为nil或者其他类型为零值时不写入
+func omitEmptyTest(key string, field reflect.StructField) string {
+	if field.Type.Kind() == reflect.Ptr {
+		return key + " != null"
+	}
+	return "_empty(" + key + ") != true"
+}
+
+func upsertColumns(tags []string, metadata *MetaData) []string {
+	unique := make(map[string]bool, len(metadata.UniqueKeys))
+	for _, key := range metadata.UniqueKeys {
+		unique[key] = true
+	}
+	columns := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if _, ok := metadata.PKNames[tag]; ok || unique[tag] || metadata.IsInsertOnly(tag) || metadata.IsReadOnly(tag) {
+			continue
+		}
+		columns = append(columns, tag)
+	}
+	return columns
+}
+
+// ByMap系列方法支持的条件前缀
+// test为条件生效的表达式，sql为条件语句，%[1]s为参数名，%[2]s为列名，%[3]s为like的转义子句
+type mapOperator struct {
+	prefix string
+	test   string
+	sql    string
+}
+
+const notEmptyTest = `%[1]s != null && %[1]s != '' && %[1]s != 0`
+
+var mapOperators = []mapOperator{
+	{"EQ", notEmptyTest, `%[2]s = #{%[1]s}`},
+	{"NE", notEmptyTest, `%[2]s <> #{%[1]s}`},
+	{"GT", notEmptyTest, `%[2]s > #{%[1]s}`},
+	{"LT", notEmptyTest, `%[2]s < #{%[1]s}`},
+	{"GTE", notEmptyTest, `%[2]s >= #{%[1]s}`},
+	{"LTE", notEmptyTest, `%[2]s <= #{%[1]s}`},
+	{"LIKE", notEmptyTest, `%[2]s like #{_like(%[1]s, 'both')}%[3]s`},
+	{"NOT_LIKE", notEmptyTest, `%[2]s not like #{_like(%[1]s, 'both')}%[3]s`},
+	{"LIKE_LEFT", notEmptyTest, `%[2]s like #{_like(%[1]s, 'left')}%[3]s`},
+	{"LIKE_RIGHT", notEmptyTest, `%[2]s like #{_like(%[1]s, 'right')}%[3]s`},
+	// 元素名按列区分，加密的列可以按 _in_列名 标记每个元素需要加密
+	{"IN", notEmptyTest, `%[2]s in <foreach collection='%[1]s' item='_in_%[2]s' separator=',' open='(' close=')'>#{_in_%[2]s}</foreach>`},
+	{"NOT_IN", notEmptyTest, `%[2]s not in <foreach collection='%[1]s' item='_in_%[2]s' separator=',' open='(' close=')'>#{_in_%[2]s}</foreach>`},
+	// 区间为两个元素的切片
+	{"BETWEEN", `_range(%[1]s)`, `%[2]s between #{%[1]s.0} and #{%[1]s.1}`},
+	{"NOT_BETWEEN", `_range(%[1]s)`, `%[2]s not between #{%[1]s.0} and #{%[1]s.1}`},
+	// 值为true时生效
+	{"IS_NULL", `%[1]s == true`, `%[2]s is null`},
+	{"IS_NOT_NULL", `%[1]s == true`, `%[2]s is not null`},
+}
+
+// 构造conditionMap，prefix为条件所在的map，如 condition.
+func buildMapCondition(builder *strings.Builder, prefix, column string) {
+	likeEscape := database.GetDialect().LikeEscape()
+	for _, operator := range mapOperators {
+		key := prefix + operator.prefix + "_" + column
+		test := fmt.Sprintf(operator.test, key)
+		sql := fmt.Sprintf(operator.sql, key, column, likeEscape)
+		builder.WriteString(fmt.Sprintf(` <if test="%s"> and %s </if>`, test, sql))
+	}
+}
+
+// OR分组，OR的值为map的切片，每个map内的条件用and连接，map之间用or连接，整体作为一个and条件
+// 如 {"OR": []map[string]interface{}{{"EQ_name": "a"}, {"GT_age": 18}}} 生成 and ((name = ?) or (age > ?))
+// 空的map跳过，所有map都为空时不生成条件
+func buildOrGroup(builder *strings.Builder, prefix string, columns []string) {
+	builder.WriteString(fmt.Sprintf(` <if test="%[1]sOR != null"><trim prefix="and (" suffix=")"><foreach collection='%[1]sOR' item='_or' separator=' or '><if test="_len(_or) > 0"><trim prefix="(" suffix=")" prefixOverrides="and">`, prefix))
+	for _, column := range columns {
+		buildMapCondition(builder, "_or.", column)
+	}
+	builder.WriteString(`</trim></if></foreach></trim></if>`)
 }
 
 type User struct {
@@ -0,0 +1,188 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"vodka/analyzer"
+	"vodka/util"
+)
+
+// 写入前校验失败的字段
+type FieldError struct {
+	Index   int    // 批量写入时为元素的下标，否则为0
+	Field   string // 结构体的字段名
+	Column  string // 列名
+	Rule    string // 未通过的规则，如required、max
+	Message string
+}
+
+// 写入前校验失败，Fields包含所有未通过校验的字段，可以使用 errors.As 判断
+type ValidationError struct {
+	Table  string
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Message)
+	}
+	return fmt.Sprintf("表 %s 校验失败: %s", e.Table, strings.Join(messages, "; "))
+}
+
+// 字段的校验规则，在check标签中声明，如 check:"required,max=50,regexp=^[a-z]+$"
+// required: 不能为零值，指针不能为nil
+// min、max: 数字的取值范围，字符串为字符数，切片和map为元素个数
+// regexp: 字符串必须匹配的正则，必须是最后一个规则，其后的逗号属于正则
+type fieldCheck struct {
+	index    []int
+	field    string
+	column   string
+	required bool
+	min      *float64
+	max      *float64
+	pattern  *regexp.Regexp
+}
+
+func parseChecks(fields []reflect.StructField) ([]*fieldCheck, error) {
+	var checks []*fieldCheck
+	for _, field := range fields {
+		tag := field.Tag.Get("check")
+		if tag == "" {
+			continue
+		}
+		check := &fieldCheck{index: field.Index, field: field.Name, column: util.VoName(field.Tag.Get("vo"))}
+		parts := strings.Split(tag, ",")
+		for i := 0; i < len(parts); i++ {
+			rule := strings.TrimSpace(parts[i])
+			name, value, _ := strings.Cut(rule, "=")
+			switch name {
+			case "required":
+				check.required = true
+			case "min", "max":
+				limit, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("字段 %s 的校验规则 %s 不是数字", field.Name, rule)
+				}
+				if name == "min" {
+					check.min = &limit
+				} else {
+					check.max = &limit
+				}
+			case "regexp":
+				pattern, err := regexp.Compile(strings.Join(append([]string{value}, parts[i+1:]...), ","))
+				if err != nil {
+					return nil, fmt.Errorf("字段 %s 的正则错误: %w", field.Name, err)
+				}
+				check.pattern = pattern
+				i = len(parts)
+			case "":
+			default:
+				return nil, fmt.Errorf("字段 %s 的校验规则 %s 不存在", field.Name, rule)
+			}
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Ptr {
+			kind = field.Type.Elem().Kind()
+		}
+		if (check.min != nil || check.max != nil) && !measurable(kind) {
+			return nil, fmt.Errorf("字段 %s 的类型 %s 不支持min、max", field.Name, field.Type)
+		}
+		if check.pattern != nil && kind != reflect.String {
+			return nil, fmt.Errorf("字段 %s 的类型 %s 不支持regexp", field.Name, field.Type)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func measurable(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return isIntegerKind(kind)
+}
+
+// 数字的值，字符串的字符数，切片和map的元素个数
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), "长度"
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), "元素个数"
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	}
+	return float64(value.Int()), ""
+}
+
+// 校验一个实体，skipZero为true时忽略零值，因为零值不会被写入
+// 其余情况下零值同样校验min、max、regexp，可选的字段需要声明为指针
+func (c *fieldCheck) validate(entity reflect.Value, skipZero bool, index int) *FieldError {
+	value := entity.FieldByIndex(c.index)
+	fail := func(rule, message string) *FieldError {
+		return &FieldError{Index: index, Field: c.field, Column: c.column, Rule: rule, Message: c.column + " " + message}
+	}
+	if value.IsZero() {
+		if c.required && !skipZero {
+			return fail("required", "不能为空")
+		}
+		if value.Kind() == reflect.Ptr || skipZero {
+			return nil
+		}
+	}
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if c.min != nil || c.max != nil {
+		n, unit := measure(value)
+		if c.min != nil && n < *c.min {
+			return fail("min", fmt.Sprintf("%s不能小于 %v", unit, *c.min))
+		}
+		if c.max != nil && n > *c.max {
+			return fail("max", fmt.Sprintf("%s不能大于 %v", unit, *c.max))
+		}
+	}
+	if c.pattern != nil && !c.pattern.MatchString(value.String()) {
+		return fail("regexp", "格式不正确")
+	}
+	return nil
+}
+
+// 执行前校验参数中的实体，单个实体或实体的切片，所有未通过的字段合并为一个ValidationError
+// skipZero返回true的列为零值时不写入，也不校验，如UpdateSelectiveById的所有列、插入时omitempty的列
+func bindCheck(function *analyzer.Function, checks []*fieldCheck, table string, skipZero func(column string) bool) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		var fields []*FieldError
+		validate := func(entity reflect.Value, index int) {
+			if entity.Kind() != reflect.Ptr || entity.IsNil() {
+				return
+			}
+			for _, check := range checks {
+				if err := check.validate(entity.Elem(), skipZero != nil && skipZero(check.column), index); err != nil {
+					fields = append(fields, err)
+				}
+			}
+		}
+		value := reflect.ValueOf(params["params"])
+		if value.Kind() == reflect.Slice {
+			for i := 0; i < value.Len(); i++ {
+				validate(value.Index(i), i)
+			}
+		} else {
+			validate(value, 0)
+		}
+		if len(fields) > 0 {
+			return &ValidationError{Table: table, Fields: fields}
+		}
+		return execute(resultWrappers, params)
+	}
+}
@@ -0,0 +1,158 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"vodka/analyzer"
+	"vodka/util"
+)
+
+// 列的写入选项，在vo标签中声明
+// readonly: 由数据库生成的列，插入和更新时都不写入，如 vo:"created_at,readonly"
+// insertonly: 只在插入时写入，更新方法不会修改，如 vo:"created_by,insertonly"
+// omitempty: 插入时零值不写入，使用数据库的默认值，如 vo:"note,omitempty"
+// encrypt: 写入时加密，查询时解密，encrypt=deterministic时可以等值查询，如 vo:"phone,encrypt=deterministic"
+type ColumnOptions struct {
+	ReadOnly   []string
+	InsertOnly []string
+	OmitEmpty  []string
+	Encrypt    map[string]bool // 加密的列，value为是否使用确定性加密
+}
+
+func parseColumnOptions(fields []reflect.StructField, pks []string) (ColumnOptions, error) {
+	var options ColumnOptions
+	for _, field := range fields {
+		voTag := util.ParseVoTag(field.Tag.Get("vo"))
+		if voTag.Has("readonly") && voTag.Has("insertonly") {
+			return options, fmt.Errorf("列 %s 不能同时声明readonly和insertonly", voTag.Name)
+		}
+		if voTag.Has("readonly") {
+			if containsString(pks, voTag.Name) {
+				return options, fmt.Errorf("主键 %s 不能声明为readonly", voTag.Name)
+			}
+			options.ReadOnly = append(options.ReadOnly, voTag.Name)
+		}
+		if voTag.Has("insertonly") {
+			options.InsertOnly = append(options.InsertOnly, voTag.Name)
+		}
+		if voTag.Has("omitempty") {
+			options.OmitEmpty = append(options.OmitEmpty, voTag.Name)
+		}
+		if encrypted, deterministic := util.VoEncrypt(field.Tag.Get("vo")); encrypted {
+			if err := checkEncryptColumn(field, voTag, pks); err != nil {
+				return options, err
+			}
+			if options.Encrypt == nil {
+				options.Encrypt = make(map[string]bool)
+			}
+			options.Encrypt[voTag.Name] = deterministic
+		}
+	}
+	return options, nil
+}
+
+// 只读的列，插入和更新时都不写入
+func (m *MetaData) IsReadOnly(column string) bool {
+	return containsString(m.Columns.ReadOnly, column)
+}
+
+// 只在插入时写入的列，包括声明了insertonly和fill=insert的列
+func (m *MetaData) IsInsertOnly(column string) bool {
+	return containsString(m.Columns.InsertOnly, column) || isInsertOnlyFill(m.FillFields, column)
+}
+
+// 插入时零值不写入的列
+func (m *MetaData) IsOmitEmpty(column string) bool {
+	return containsString(m.Columns.OmitEmpty, column)
+}
+
+// 加密的列只能是字符串，主键和omitempty的列不能加密，因为它们的值会出现在不经过加密的表达式中
+func checkEncryptColumn(field reflect.StructField, voTag util.VoTag, pks []string) error {
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() != reflect.String && fieldType != reflect.TypeOf([]byte(nil)) {
+		return fmt.Errorf("加密的列 %s 只能是字符串，实际为 %s", voTag.Name, field.Type)
+	}
+	if containsString(pks, voTag.Name) {
+		return fmt.Errorf("主键 %s 不能加密", voTag.Name)
+	}
+	if voTag.Has("omitempty") {
+		return fmt.Errorf("加密的列 %s 不能声明omitempty", voTag.Name)
+	}
+	if mode := voTag.Get("encrypt", ""); mode != "" && mode != "deterministic" {
+		return fmt.Errorf("列 %s 的加密方式 %s 不存在", voTag.Name, mode)
+	}
+	return nil
+}
+
+// 通用Mapper中map参数的加密列，确定性加密的列的等值条件（EQ、NE、IN、NOT_IN）加密后再比较
+// 随机加密的列每次加密的结果都不同，除了IS_NULL、IS_NOT_NULL以外不能作为条件，使用时返回错误，而不是静默地查不到数据
+func bindEncrypt(function *analyzer.Function, columns map[string]bool) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		for column, deterministic := range columns {
+			analyzer.MarkEncrypted(params, "action."+column, deterministic)
+			if !deterministic {
+				if err := checkRandomCondition(function.Id, params, column); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, prefix := range []string{"", "condition.", "_or."} {
+				analyzer.MarkEncrypted(params, prefix+"EQ_"+column, true)
+				analyzer.MarkEncrypted(params, prefix+"NE_"+column, true)
+			}
+			analyzer.MarkEncrypted(params, "_in_"+column, true)
+		}
+		return execute(resultWrappers, params)
+	}
+}
+
+// 使用实体作为条件的方法和实体所在的参数
+var structConditionParams = map[string]string{
+	"SelectOne":         "params",
+	"SelectAll":         "params",
+	"CountAll":          "params",
+	"UpdateByCondition": "condition",
+	"DeleteByCondition": "condition",
+}
+
+// 随机加密的列是否被用作条件，包括map条件（含OR分组）和实体条件中有值的字段
+func checkRandomCondition(functionId string, params map[string]interface{}, column string) error {
+	conditions := []map[string]interface{}{params}
+	if condition, ok := params["condition"].(map[string]interface{}); ok {
+		conditions = append(conditions, condition)
+	}
+	for _, condition := range conditions {
+		if groups, ok := condition["OR"].([]map[string]interface{}); ok {
+			conditions = append(conditions, groups...)
+		}
+	}
+	for _, condition := range conditions {
+		for _, operator := range mapOperators {
+			if operator.prefix == "IS_NULL" || operator.prefix == "IS_NOT_NULL" {
+				continue
+			}
+			if value, ok := condition[operator.prefix+"_"+column]; ok && value != nil {
+				return fmt.Errorf("列 %s 使用随机加密，不能作为 %s 条件，需要查询时请声明encrypt=deterministic", column, operator.prefix)
+			}
+		}
+	}
+	name, ok := structConditionParams[functionId]
+	if !ok {
+		return nil
+	}
+	entity := reflect.ValueOf(params[name])
+	if entity.Kind() != reflect.Ptr || entity.IsNil() || entity.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	entity = entity.Elem()
+	for i := 0; i < entity.NumField(); i++ {
+		if util.VoName(entity.Type().Field(i).Tag.Get("vo")) == column && !entity.Field(i).IsZero() {
+			return fmt.Errorf("列 %s 使用随机加密，不能作为条件，需要查询时请声明encrypt=deterministic", column)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+	"vodka/analyzer"
+	"vodka/runner"
+	"vodka/util"
+)
+
+// 自动填充的时机
+type FillOperation string
+
+const (
+	FillInsert FillOperation = "insert"
+	FillUpdate FillOperation = "update"
+)
+
+// 自动填充的值，返回列名到值的映射，只有声明了对应fill选项的列才会被填充
+// entity为实体的指针，op为当前的操作，ctx为WithContext传入的上下文，没有时为context.Background()
+type FillHandler func(ctx context.Context, entity interface{}, op FillOperation) map[string]interface{}
+
+var (
+	fillHandler     FillHandler
+	fillHandlerLock sync.RWMutex
+)
+
+// 注册自动填充的处理器，后注册的会覆盖之前的
+func RegisterFillHandler(handler FillHandler) {
+	fillHandlerLock.Lock()
+	defer fillHandlerLock.Unlock()
+	fillHandler = handler
+}
+
+func getFillHandler() FillHandler {
+	fillHandlerLock.RLock()
+	defer fillHandlerLock.RUnlock()
+	return fillHandler
+}
+
+// 需要自动填充的列，在vo标签中使用fill声明，如 vo:"created_at,fill=insert"
+// fill的值为insert、update或insert_update
+// 插入时只填充零值的字段，更新时总是覆盖；处理器没有提供值时，时间类型的字段填充为当前时间
+type FillField struct {
+	Column    string
+	Insert    bool
+	Update    bool
+	index     []int
+	fieldType reflect.Type
+}
+
+// 只在插入时填充的列，不会被更新方法修改
+func (f *FillField) InsertOnly() bool {
+	return f.Insert && !f.Update
+}
+
+func parseFillFields(fields []reflect.StructField) ([]*FillField, error) {
+	var fillFields []*FillField
+	for _, field := range fields {
+		voTag := util.ParseVoTag(field.Tag.Get("vo"))
+		if !voTag.Has("fill") {
+			continue
+		}
+		fillField := &FillField{Column: voTag.Name, index: field.Index, fieldType: field.Type}
+		switch voTag.Options["fill"] {
+		case "insert":
+			fillField.Insert = true
+		case "update":
+			fillField.Update = true
+		case "insert_update":
+			fillField.Insert = true
+			fillField.Update = true
+		default:
+			return nil, fmt.Errorf("列 %s 的fill必须是insert、update或insert_update: %s", voTag.Name, voTag.Options["fill"])
+		}
+		fillFields = append(fillFields, fillField)
+	}
+	return fillFields, nil
+}
+
+// 是否是只在插入时填充的列
+func isInsertOnlyFill(fillFields []*FillField, column string) bool {
+	for _, fillField := range fillFields {
+		if fillField.Column == column && fillField.InsertOnly() {
+			return true
+		}
+	}
+	return false
+}
+
+// 填充一个实体，entity为实体的指针，返回被填充的字段
+func fillEntity(fillFields []*FillField, entity reflect.Value, op FillOperation) (map[string]reflect.Value, error) {
+	var values map[string]interface{}
+	if handler := getFillHandler(); handler != nil {
+		values = handler(CurrentContext(), entity.Interface(), op)
+	}
+	filled := make(map[string]reflect.Value)
+	now := time.Now()
+	for _, fillField := range fillFields {
+		if (op == FillInsert && !fillField.Insert) || (op == FillUpdate && !fillField.Update) {
+			continue
+		}
+		field := entity.Elem().FieldByIndex(fillField.index)
+		if op == FillInsert && !field.IsZero() {
+			continue
+		}
+		value, ok := values[fillField.Column]
+		if !ok {
+			// 时间类型默认使用当前时间
+			if fillField.fieldType == timeType {
+				value, ok = now, true
+			} else if fillField.fieldType == reflect.PointerTo(timeType) {
+				value, ok = &now, true
+			}
+		}
+		if !ok || value == nil {
+			continue
+		}
+		fieldValue := reflect.ValueOf(value)
+		if fieldValue.Type().AssignableTo(field.Type()) {
+			field.Set(fieldValue)
+		} else if fieldValue.Type().ConvertibleTo(field.Type()) {
+			field.Set(fieldValue.Convert(field.Type()))
+		} else {
+			return nil, fmt.Errorf("自动填充的值 %T 不能赋值给列 %s", value, fillField.Column)
+		}
+		filled[fillField.Column] = field
+	}
+	return filled, nil
+}
+
+// 执行前填充params中的实体，实体为单个指针时，同时更新已经展开的参数
+func bindFill(function *analyzer.Function, fillFields []*FillField, op FillOperation) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		entity := reflect.ValueOf(params["params"])
+		switch entity.Kind() {
+		case reflect.Ptr:
+			if entity.IsNil() {
+				break
+			}
+			filled, err := fillEntity(fillFields, entity, op)
+			if err != nil {
+				return err
+			}
+			for column, field := range filled {
+				if _, ok := params[column]; ok {
+					params[column] = runner.FieldValue(field)
+				}
+			}
+			// UpdateFieldsById同时更新被填充的列
+			if fields, ok := params["_fields"].([]string); ok && len(fields) > 0 {
+				fields = append([]string{}, fields...)
+				for _, fillField := range fillFields {
+					if _, ok := filled[fillField.Column]; ok && !containsString(fields, fillField.Column) {
+						fields = append(fields, fillField.Column)
+					}
+				}
+				params["_fields"] = fields
+			}
+		case reflect.Slice:
+			for i := 0; i < entity.Len(); i++ {
+				if elem := entity.Index(i); !elem.IsNil() {
+					if _, err := fillEntity(fillFields, elem, op); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return execute(resultWrappers, params)
+	}
+}
+
+// 查询构造器的Update按列名更新，没有实体：把values写入entity后填充update的列，再校验被更新的列
+// entity为新建的实体指针，返回加上被填充的列之后的values，不修改传入的map
+func PrepareUpdateValues(metadata *MetaData, entity interface{}, values map[string]interface{}) (map[string]interface{}, error) {
+	if len(metadata.FillFields) == 0 && len(metadata.checks) == 0 {
+		return values, nil
+	}
+	value := reflect.ValueOf(entity)
+	elem := value.Elem()
+	for i := 0; i < elem.NumField(); i++ {
+		column := util.VoName(elem.Type().Field(i).Tag.Get("vo"))
+		if v, ok := values[column]; ok {
+			if err := util.AssignValue(elem.Field(i), v); err != nil {
+				return nil, fmt.Errorf("列 %s 的值错误: %w", column, err)
+			}
+		}
+	}
+	result := make(map[string]interface{}, len(values))
+	for column, v := range values {
+		result[column] = v
+	}
+	filled, err := fillEntity(metadata.FillFields, value, FillUpdate)
+	if err != nil {
+		return nil, err
+	}
+	for column, field := range filled {
+		result[column] = runner.FieldValue(field)
+	}
+	var fields []*FieldError
+	for _, check := range metadata.checks {
+		if _, ok := result[check.column]; !ok {
+			continue
+		}
+		if err := check.validate(elem, false, 0); err != nil {
+			fields = append(fields, err)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Table: metadata.TableName, Fields: fields}
+	}
+	return result, nil
+}
+
+// 当前协程的上下文
+var contextLocal = util.NewThreadLocal(false)
+
+// 在fn中执行的语句，自动填充处理器可以通过ctx获取当前用户等信息
+// 和事务一样绑定在当前协程上，可以嵌套，结束后恢复外层的上下文
+func WithContext(ctx context.Context, fn func()) {
+	previous, ok := contextLocal.Get()
+	contextLocal.Set(ctx)
+	defer func() {
+		if ok {
+			contextLocal.Set(previous)
+		} else {
+			contextLocal.Remove()
+		}
+	}()
+	fn()
+}
+
+// 当前协程的上下文，不在WithContext中时返回context.Background()
+func CurrentContext() context.Context {
+	if ctx, ok := contextLocal.Get(); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
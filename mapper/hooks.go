@@ -0,0 +1,168 @@
+package mapper
+
+import (
+	"context"
+	"reflect"
+	"vodka/analyzer"
+)
+
+// 实体的生命周期回调，实体实现对应的接口即可，ctx为WithContext传入的上下文
+// 写入前的回调可以修改实体，返回错误时不执行语句；写入后的回调返回错误时回滚语句
+// AfterFind在查询结果映射到实体后调用，可以计算派生字段
+
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+// 实体在语句执行前的回调，没有实现时返回nil
+func beforeHook(statementType string, entity interface{}) func(context.Context) error {
+	switch statementType {
+	case "INSERT":
+		if hook, ok := entity.(BeforeInserter); ok {
+			return hook.BeforeInsert
+		}
+	case "UPDATE":
+		if hook, ok := entity.(BeforeUpdater); ok {
+			return hook.BeforeUpdate
+		}
+	case "DELETE":
+		if hook, ok := entity.(BeforeDeleter); ok {
+			return hook.BeforeDelete
+		}
+	}
+	return nil
+}
+
+// 实体在语句执行后的回调，没有实现时返回nil
+func afterHook(statementType string, entity interface{}) func(context.Context) error {
+	switch statementType {
+	case "INSERT":
+		if hook, ok := entity.(AfterInserter); ok {
+			return hook.AfterInsert
+		}
+	case "UPDATE":
+		if hook, ok := entity.(AfterUpdater); ok {
+			return hook.AfterUpdate
+		}
+	case "DELETE":
+		if hook, ok := entity.(AfterDeleter); ok {
+			return hook.AfterDelete
+		}
+	}
+	return nil
+}
+
+// 实体是否实现了statementType对应的写入前或写入后的回调
+func HasWriteHook(statementType string, entity interface{}) bool {
+	return beforeHook(statementType, entity) != nil || afterHook(statementType, entity) != nil
+}
+
+// 按参数顺序取出参数中的实体，包括结构体指针和结构体指针的切片
+// 更新语句中名为condition的参数是where条件，不是被更新的实体
+func hookEntities(statementType string, paramNames []string, params map[string]interface{}) []interface{} {
+	var entities []interface{}
+	for _, name := range paramNames {
+		if statementType == "UPDATE" && name == "condition" {
+			continue
+		}
+		entities = appendEntities(entities, reflect.ValueOf(params[name]))
+	}
+	return entities
+}
+
+func appendEntities(entities []interface{}, value reflect.Value) []interface{} {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+			entities = append(entities, value.Interface())
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if elem := value.Index(i); elem.Kind() == reflect.Ptr {
+				entities = appendEntities(entities, elem)
+			}
+		}
+	}
+	return entities
+}
+
+// 调用方法，并在执行前后调用参数中实体的回调，查询语句在结果映射后脱敏并调用AfterFind
+// 写入前的回调必须在CallFunction展开参数之前调用，回调中对实体的修改才会生效
+func callWithHooks(function *analyzer.Function, paramNames []string, params map[string]interface{}, resultWrappers []interface{}) error {
+	if function.Type == "SELECT" {
+		if err := analyzer.CallFunction(function, params, resultWrappers); err != nil {
+			return err
+		}
+		return AfterQuery(resultWrappers)
+	}
+	ctx := CurrentContext()
+	var afters []func(context.Context) error
+	for _, entity := range hookEntities(function.Type, paramNames, params) {
+		if before := beforeHook(function.Type, entity); before != nil {
+			if err := before(ctx); err != nil {
+				return err
+			}
+		}
+		if after := afterHook(function.Type, entity); after != nil {
+			afters = append(afters, after)
+		}
+	}
+	if len(afters) == 0 {
+		return analyzer.CallFunction(function, params, resultWrappers)
+	}
+	// 写入后的回调返回错误时需要回滚，所以和语句在同一个事务中执行
+	return analyzer.Transaction(func() error {
+		if err := analyzer.CallFunction(function, params, resultWrappers); err != nil {
+			return err
+		}
+		for _, after := range afters {
+			if err := after(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 对查询结果中的实体调用AfterFind，resultWrappers为QueryStruct的dest，如*[]*T、**T
+func CallAfterFind(resultWrappers []interface{}) error {
+	ctx := CurrentContext()
+	for _, wrapper := range resultWrappers {
+		value := reflect.ValueOf(wrapper)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			continue
+		}
+		for _, entity := range appendEntities(nil, value.Elem()) {
+			if hook, ok := entity.(AfterFinder); ok {
+				if err := hook.AfterFind(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"vodka/analyzer"
+	"vodka/keygen"
+	"vodka/runner"
+	"vodka/util"
+)
+
+// 主键生成器，在 _ 字段上使用keygen声明，如 _ struct{} `table:"user" pk:"id" keygen:"snowflake"`
+// 插入前主键为零值时生成，内置snowflake、uuid和ulid，也可以通过keygen.Register注册自定义的生成器
+type KeyGenerator struct {
+	Column string
+	name   string
+	index  []int
+}
+
+func parseKeyGenerator(name string, pks []string, fields []reflect.StructField, tags []string) (*KeyGenerator, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if len(pks) != 1 {
+		return nil, fmt.Errorf("主键生成器 %s 只能用于单一主键", name)
+	}
+	if _, ok := keygen.Get(name); !ok {
+		return nil, fmt.Errorf("未找到主键生成器: %s", name)
+	}
+	for i, tag := range tags {
+		if tag == pks[0] {
+			return &KeyGenerator{Column: tag, name: name, index: fields[i].Index}, nil
+		}
+	}
+	return nil, fmt.Errorf("主键 %s 没有对应的vo标签", pks[0])
+}
+
+// 主键为零值时生成并设置到实体中，entity为实体的指针
+func (k *KeyGenerator) generate(entity reflect.Value) (reflect.Value, bool, error) {
+	field := entity.Elem().FieldByIndex(k.index)
+	if !field.IsZero() {
+		return field, false, nil
+	}
+	// 每次插入时查找，重新注册的生成器立即生效
+	generator, ok := keygen.Get(k.name)
+	if !ok {
+		return field, false, fmt.Errorf("未找到主键生成器: %s", k.name)
+	}
+	value, err := generator()
+	if err != nil {
+		return field, false, fmt.Errorf("生成主键 %s 失败: %w", k.Column, err)
+	}
+	if value == nil {
+		return field, false, fmt.Errorf("主键生成器返回了nil: %s", k.Column)
+	}
+	if err := util.AssignValue(field, value); err != nil {
+		return field, false, fmt.Errorf("生成的主键不能赋值给列 %s: %w", k.Column, err)
+	}
+	return field, true, nil
+}
+
+// 执行前为params中的实体生成主键，实体为单个指针时，同时更新已经展开的参数
+func (k *KeyGenerator) bind(function *analyzer.Function) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		entity := reflect.ValueOf(params["params"])
+		switch entity.Kind() {
+		case reflect.Ptr:
+			if entity.IsNil() {
+				break
+			}
+			field, generated, err := k.generate(entity)
+			if err != nil {
+				return err
+			}
+			if generated {
+				params[k.Column] = runner.FieldValue(field)
+			}
+		case reflect.Slice:
+			for i := 0; i < entity.Len(); i++ {
+				if elem := entity.Index(i); !elem.IsNil() {
+					if _, _, err := k.generate(elem); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return execute(resultWrappers, params)
+	}
+}
@@ -0,0 +1,26 @@
+package mapper
+
+import (
+	"errors"
+	"vodka/analyzer"
+	"vodka/database"
+)
+
+// 加锁查询执行前取出调用方指定的锁，_locks为可变参数，没有指定时使用语句上的for update
+func bindLock(function *analyzer.Function) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		locks, _ := params["_locks"].([]database.Lock)
+		if len(locks) > 1 {
+			return errors.New("加锁查询只能指定一个锁")
+		}
+		if len(locks) == 1 {
+			lock, err := database.ParseLock(string(locks[0]))
+			if err != nil {
+				return err
+			}
+			analyzer.SetLock(params, lock)
+		}
+		return execute(resultWrappers, params)
+	}
+}
@@ -0,0 +1,119 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+	"vodka/analyzer"
+	"vodka/util"
+)
+
+// 逻辑删除列，在vo标签中使用logic_delete声明，如 vo:"deleted,logic_delete"
+// 默认已删除为1，未删除为0，可以通过deleted_value、normal_value修改，值会原样写入sql，字符串需要带引号
+// 列为*time.Time时，删除时写入当前时间，未删除为NULL；time.Time无法表示NULL，不能作为逻辑删除列
+// 插入时逻辑删除列总是写入未删除的值，忽略实体中的值
+type LogicDelete struct {
+	Column       string
+	DeletedValue string
+	NormalValue  string
+	Timestamp    bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 从实体的字段中找到逻辑删除列，最多只能有一个
+func parseLogicDelete(fields []reflect.StructField) (*LogicDelete, error) {
+	var logicDelete *LogicDelete
+	for _, field := range fields {
+		voTag := util.ParseVoTag(field.Tag.Get("vo"))
+		if !voTag.Has("logic_delete") {
+			continue
+		}
+		if logicDelete != nil {
+			return nil, fmt.Errorf("逻辑删除列只能有一个: %s, %s", logicDelete.Column, voTag.Name)
+		}
+		if field.Type == timeType {
+			return nil, fmt.Errorf("逻辑删除列 %s 必须声明为*time.Time，未删除时为NULL", voTag.Name)
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		logicDelete = &LogicDelete{
+			Column:       voTag.Name,
+			DeletedValue: voTag.Get("deleted_value", "1"),
+			NormalValue:  voTag.Get("normal_value", "0"),
+			Timestamp:    fieldType == timeType,
+		}
+	}
+	return logicDelete, nil
+}
+
+// 未删除的条件
+func (l *LogicDelete) Condition() string {
+	if l.Timestamp {
+		return l.Column + " is null"
+	}
+	return l.Column + " = " + l.NormalValue
+}
+
+// 插入时写入的值，时间类型为NULL
+func (l *LogicDelete) insertValue() string {
+	if l.Timestamp {
+		return "NULL"
+	}
+	return l.NormalValue
+}
+
+// 删除时的set语句，时间类型的值为_now()
+func (l *LogicDelete) Assignment() string {
+	if l.Timestamp {
+		return l.Column + " = #{_now()}"
+	}
+	return l.Column + " = " + l.DeletedValue
+}
+
+// xml中附加在where里的过滤条件，Unscoped时不生效
+func (l *LogicDelete) filter() string {
+	if l == nil {
+		return ""
+	}
+	return fmt.Sprintf(` <if test="_unscoped != true"> and %s </if>`, l.Condition())
+}
+
+// 删除语句的开头，Unscoped时物理删除，否则改为更新逻辑删除列
+func (l *LogicDelete) deleteFrom(table string) string {
+	if l == nil {
+		return "delete from " + table
+	}
+	return fmt.Sprintf(`<if test="_unscoped == true">delete from %[1]s</if><if test="_unscoped != true">update %[1]s set %[2]s</if>`, table, l.Assignment())
+}
+
+// 当前协程是否在Unscoped中
+var unscopedLocal = util.NewThreadLocal(false)
+
+// 在fn中执行的通用Mapper方法和查询构造器不附加逻辑删除的过滤条件，删除方法物理删除
+// 和事务一样绑定在当前协程上，fn中新开的协程不受影响
+func Unscoped(fn func()) {
+	if IsUnscoped() {
+		fn()
+		return
+	}
+	unscopedLocal.Set(true)
+	defer unscopedLocal.Remove()
+	fn()
+}
+
+func IsUnscoped() bool {
+	_, ok := unscopedLocal.Get()
+	return ok
+}
+
+// 执行前将当前协程是否Unscoped放入参数_unscoped中
+func bindUnscoped(function *analyzer.Function) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		params["_unscoped"] = IsUnscoped()
+		return execute(resultWrappers, params)
+	}
+}
@@ -2,6 +2,7 @@ package mapper
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -10,15 +11,14 @@ import (
 	analyzer "vodka/analyzer"
 )
 
-var mappers map[string]*Mapper
+// 未调用ScanMapper时也可以直接InitMapper
+var mappers = make(map[string]*Mapper)
 
-//= make(map[string]*Mapper)
 // var mappersLock = sync.RWMutex{}
 
 // 缓存，不用每次都重新绑定
-var mapperCache map[string]interface{}
+var mapperCache = make(map[string]interface{})
 
-// = make(map[string]interface{})
 var mapperCacheLock = sync.RWMutex{}
 
 // initmapper的锁
@@ -39,6 +39,7 @@ type MapperItem struct {
 func ScanMapper(dir string) error {
 	var wg sync.WaitGroup
 	var analyzers []*analyzer.Analyzer
+	var parseErrs []error
 	rwMutex := sync.RWMutex{}
 
 	// 遍历指定目录
@@ -60,9 +61,13 @@ func ScanMapper(dir string) error {
 				println("找到XML文件:", path)
 				defer wg.Done()
 				parser := analyzer.NewAnalyzer(string(content))
-				parser.Parse()
+				parseErr := parser.Parse()
 				rwMutex.Lock()
 				defer rwMutex.Unlock()
+				if parseErr != nil {
+					parseErrs = append(parseErrs, fmt.Errorf("%s: %w", path, parseErr))
+					return
+				}
 				analyzers = append(analyzers, parser)
 			}(path)
 		}
@@ -73,6 +78,10 @@ func ScanMapper(dir string) error {
 	if err != nil {
 		return err
 	}
+	// 任何一个xml编译失败都不初始化，错误在启动时暴露
+	if len(parseErrs) > 0 {
+		return errors.Join(parseErrs...)
+	}
 	// 整理所有的analyzer，将相同命名空间的mapper集合到一起
 	return InitMappers(analyzers)
 }
@@ -152,7 +161,10 @@ func InitMapper(source interface{}) error {
 // 为其生成方法
 func bindMapper(source interface{}, mapper *Mapper, mapperValue reflect.Value, mapperType reflect.Type, v reflect.Value) error {
 	// 获得metadata
-	metaData := NewMetaData(mapper.NameSpace, mapperValue)
+	metaData, err := NewMetaData(mapper.NameSpace, mapperValue)
+	if err != nil {
+		return err
+	}
 	if metaData != nil {
 		for _, function := range metaData.Functions {
 			mapper.FunctionMap[function.Id] = function
@@ -262,6 +274,13 @@ func generateFunctionBody(mapper *Mapper, v reflect.Value, field reflect.StructF
 			} else if resultType == reflect.TypeOf((*int64)(nil)).Elem() {
 				result = new(int64)
 				resultWrappers = append(resultWrappers, result)
+			} else if resultType.Kind() == reflect.Bool {
+				result = new(bool)
+				resultWrappers = append(resultWrappers, result)
+			} else if resultType.Kind() == reflect.Float64 || resultType.Kind() == reflect.Interface {
+				// 聚合查询的结果
+				result = reflect.New(resultType).Interface()
+				resultWrappers = append(resultWrappers, result)
 			} else {
 				// 如果是结构体的话，为了成功返回nil，这里必须产生一个指针的指针，即**Struct
 				//result = reflect.New(resultType).Interface()
@@ -279,7 +298,13 @@ func generateFunctionBody(mapper *Mapper, v reflect.Value, field reflect.StructF
 			}
 		}
 
-		err := analyzer.CallFunction(mapper.FunctionMap[methodName], params, resultWrappers)
+		// 没有生成语句的方法（如没有声明pk时的通用方法）调用时返回错误
+		var err error
+		if function, ok := mapper.FunctionMap[methodName]; ok {
+			err = callWithHooks(function, paramNames, params, resultWrappers)
+		} else {
+			err = fmt.Errorf("方法 %s 没有对应的语句", methodName)
+		}
 		if err != nil {
 			// 指定的替换为错误
 			for _, index := range errIndexes {
@@ -0,0 +1,111 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"vodka/mask"
+	"vodka/util"
+)
+
+// 声明了mask标签的字段，如 mask:"phone"、mask:"custom=name"
+// 脱敏函数在使用时按rule查找，之后注册或覆盖的函数同样生效
+type maskField struct {
+	index  []int
+	column string
+	rule   string
+}
+
+type maskFieldsResult struct {
+	fields []*maskField
+	err    error
+}
+
+// 结构体中需要脱敏的字段，key为结构体类型，只和类型有关，错误也可以缓存
+var maskFieldsCache sync.Map
+
+func maskFields(structType reflect.Type) ([]*maskField, error) {
+	if result, ok := maskFieldsCache.Load(structType); ok {
+		return result.(*maskFieldsResult).fields, result.(*maskFieldsResult).err
+	}
+	result := &maskFieldsResult{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		rule := field.Tag.Get("mask")
+		if rule == "" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.String {
+			result.err = fmt.Errorf("脱敏的字段 %s 只能是字符串，实际为 %s", field.Name, field.Type)
+			break
+		}
+		column := util.VoName(field.Tag.Get("vo"))
+		if column == "" {
+			column = field.Name
+		}
+		result.fields = append(result.fields, &maskField{index: field.Index, column: column, rule: rule})
+	}
+	if result.err != nil {
+		result.fields = nil
+	}
+	maskFieldsCache.Store(structType, result)
+	return result.fields, result.err
+}
+
+// 通用Mapper的实体不能声明mask，脱敏后的实体可能被UpdateById等方法原样写回，覆盖数据库中的原值
+func checkEntityMask(entityType reflect.Type) error {
+	for i := 0; i < entityType.NumField(); i++ {
+		if field := entityType.Field(i); field.Tag.Get("mask") != "" {
+			return fmt.Errorf("实体 %s 的字段 %s 不能声明mask，脱敏的值可能被写回数据库，请在SelectAllAs使用的DTO中声明", entityType, field.Name)
+		}
+	}
+	return nil
+}
+
+// 按当前调用者脱敏查询结果，resultWrappers为QueryStruct的dest，如*[]*T、**T
+func applyMask(resultWrappers []interface{}) error {
+	ctx := CurrentContext()
+	for _, wrapper := range resultWrappers {
+		value := reflect.ValueOf(wrapper)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			continue
+		}
+		for _, entity := range appendEntities(nil, value.Elem()) {
+			entityValue := reflect.ValueOf(entity).Elem()
+			fields, err := maskFields(entityValue.Type())
+			if err != nil {
+				return err
+			}
+			for _, field := range fields {
+				if !mask.ShouldMask(ctx, field.column) {
+					continue
+				}
+				fieldValue := entityValue.FieldByIndex(field.index)
+				if fieldValue.Kind() == reflect.Ptr {
+					if fieldValue.IsNil() {
+						continue
+					}
+					fieldValue = fieldValue.Elem()
+				}
+				fn, err := mask.Lookup(field.rule)
+				if err != nil {
+					return fmt.Errorf("字段 %s: %w", field.column, err)
+				}
+				fieldValue.SetString(fn(fieldValue.String()))
+			}
+		}
+	}
+	return nil
+}
+
+// 查询结果映射到实体后的处理，先按当前调用者脱敏，再调用AfterFind
+func AfterQuery(resultWrappers []interface{}) error {
+	if err := applyMask(resultWrappers); err != nil {
+		return err
+	}
+	return CallAfterFind(resultWrappers)
+}
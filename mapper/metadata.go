@@ -1,45 +1,83 @@
 package mapper
 
 import (
+	"log"
 	"reflect"
 	"strings"
+	"sync"
 	"vodka/analyzer"
 )
 
 type MetaData struct {
-	Namespace    string
-	TableName    string
-	PKNames      map[string]byte
-	Functions    []*analyzer.Function
+	Namespace   string
+	TableName   string
+	PKNames     map[string]byte
+	PKs         []string      // 按声明顺序排列的主键
+	UniqueKeys  []string      // 插入冲突时使用的唯一键，默认为主键
+	LogicDelete *LogicDelete  // 逻辑删除列，没有声明时为nil
+	VersionLock *VersionLock  // 乐观锁的版本号列，没有声明时为nil
+	FillFields  []*FillField  // 自动填充的列
+	checks      []*fieldCheck // 写入前的校验规则
+	KeyGen      string        // 主键生成器的名称，没有声明时为空
+	Columns     ColumnOptions // 列的写入选项
+	Tags        []string      // 实体中声明了vo标签的列，查询时按顺序列出
+	Functions   []*analyzer.Function
 	// CustomSqlMap map[string]string
 	// Fields    []reflect.StructField
-	// Tags      []string
 }
 
-func NewMetaData(namespace string, mapperValue reflect.Value) *MetaData {
+// 解析 _ 字段上的表信息，并调用BuildTags生成通用语句，生成失败时返回错误
+func NewMetaData(namespace string, mapperValue reflect.Value) (*MetaData, error) {
 	metadataField, ok := mapperValue.Elem().Type().FieldByName("_")
 	if !ok {
-		return nil
+		return nil, nil
 	}
 	metadata := &MetaData{
-		Namespace:    namespace,
-		TableName:    "",
-		PKNames:      make(map[string]byte),
-		Functions:    make([]*analyzer.Function, 0),
+		Namespace: namespace,
+		TableName: "",
+		PKNames:   make(map[string]byte),
+		Functions: make([]*analyzer.Function, 0),
 	}
+	// 表名优先使用table标签，其次是实体的TableName方法，schema标签会加在表名之前
 	tableName := metadataField.Tag.Get("table")
 	if tableName == "" {
-		return metadata
+		tableName = entityTableName(mapperValue)
+	}
+	if tableName == "" {
+		return metadata, nil
+	}
+	if schema := metadataField.Tag.Get("schema"); schema != "" {
+		tableName = schema + "." + tableName
+	}
+	if err := CheckTableName(tableName); err != nil {
+		return nil, err
 	}
 	metadata.TableName = tableName
 	pkTag := metadataField.Tag.Get("pk")
 	if pkTag != "" {
 		// 支持多个主键，用逗号分隔
 		for _, pk := range strings.Split(pkTag, ",") {
-			metadata.PKNames[strings.TrimSpace(pk)] = 1
+			pk = strings.TrimSpace(pk)
+			metadata.PKNames[pk] = 1
+			metadata.PKs = append(metadata.PKs, pk)
+		}
+	}
+	metadata.KeyGen = metadataField.Tag.Get("keygen")
+	uniqueTag := metadataField.Tag.Get("unique")
+	if uniqueTag == "" {
+		uniqueTag = pkTag
+	}
+	for _, key := range strings.Split(uniqueTag, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			metadata.UniqueKeys = append(metadata.UniqueKeys, key)
 		}
 	}
 
+	// 没有声明主键时不生成通用方法，mapper中只能使用xml和sql标签声明的方法
+	if len(metadata.PKs) == 0 {
+		log.Printf("%s 没有声明pk，不生成通用方法", namespace)
+		return metadata, nil
+	}
 	if method := mapperValue.MethodByName("BuildTags"); method.IsValid() {
 		// refErr := reflect.Zero(reflect.TypeOf(errors.New("")))
 		ret := method.Call([]reflect.Value{
@@ -48,12 +86,31 @@ func NewMetaData(namespace string, mapperValue reflect.Value) *MetaData {
 			// reflect.ValueOf(customSqlMap),
 			// refErr,
 		})
-		err, ok := ret[1].Interface().(error)
-		if !(ok && err != nil) {
-			if functions, ok := ret[0].Interface().([]*analyzer.Function); ok {
-				metadata.Functions = functions
-			}
+		if err, ok := ret[1].Interface().(error); ok && err != nil {
+			return nil, err
+		}
+		if functions, ok := ret[0].Interface().([]*analyzer.Function); ok {
+			metadata.Functions = functions
 		}
 	}
-	return metadata
+	return metadata, nil
+}
+
+// 实体类型到表信息的映射，VodkaMapper生成语句时注册，供查询构造器使用
+var entities sync.Map
+
+func registerEntity(entityType reflect.Type, metadata *MetaData) {
+	entities.Store(entityType, metadata)
+}
+
+// 获取实体对应的表信息，实体所在的VodkaMapper必须已经InitMapper
+func GetEntityMetaData(entityType reflect.Type) (*MetaData, bool) {
+	for entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+	metadata, ok := entities.Load(entityType)
+	if !ok {
+		return nil, false
+	}
+	return metadata.(*MetaData), true
 }
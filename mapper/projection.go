@@ -0,0 +1,77 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"vodka/analyzer"
+	"vodka/database"
+	"vodka/util"
+)
+
+// SelectColumnsByMap执行前校验查询的列，生成select子句
+func bindSelectColumns(function *analyzer.Function, tags []string) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		columns, _ := params["_columns"].([]string)
+		if len(columns) == 0 {
+			return errors.New("SelectColumnsByMap 必须至少指定一列")
+		}
+		for _, column := range columns {
+			if !containsString(tags, column) {
+				return fmt.Errorf("SelectColumnsByMap 不能查询列 %s，只能是实体中的列", column)
+			}
+		}
+		params["_select"] = strings.Join(columns, ",")
+		return execute(resultWrappers, params)
+	}
+}
+
+// DTO中声明了vo标签的列，没有vo标签的字段不查询
+func dtoColumns(dtoType reflect.Type) []string {
+	var columns []string
+	for i := 0; i < dtoType.NumField(); i++ {
+		field := dtoType.Field(i)
+		if !field.IsExported() || util.VoIgnored(field.Tag.Get("vo")) {
+			continue
+		}
+		if column := util.VoName(field.Tag.Get("vo")); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// 只查询DTO中声明的列，条件、排序和分页与SelectAllByMap相同，DTO中的列必须是实体中的列
+//
+//	summaries, err := vodka.SelectAllAs[UserSummary](&userMapper.VodkaMapper, map[string]interface{}{"GTE_age": 18}, "id desc", 0, 10)
+func SelectAllAs[DTO any, T any, ID any](m *VodkaMapper[T, ID], params map[string]interface{}, order string, offset int64, limit int64) ([]*DTO, error) {
+	if m.SelectColumnsByMap == nil {
+		return nil, errors.New("mapper未初始化")
+	}
+	dtoType := reflect.TypeOf((*DTO)(nil)).Elem()
+	if dtoType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s 不是结构体", dtoType)
+	}
+	columns := dtoColumns(dtoType)
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s 中没有声明vo标签的字段", dtoType)
+	}
+	rows, err := m.SelectColumnsByMap(columns, params, order, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*DTO, 0, len(rows))
+	for _, row := range rows {
+		dto := new(DTO)
+		if err := database.ScanStruct(row, reflect.ValueOf(dto).Elem()); err != nil {
+			return nil, err
+		}
+		result = append(result, dto)
+	}
+	if err := AfterQuery([]interface{}{&result}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
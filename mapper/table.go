@@ -0,0 +1,141 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"vodka/analyzer"
+	"vodka/util"
+)
+
+// 通用语句中的表名，执行时替换为当前的表名，从而支持按月分表等动态表名
+const tableParam = "${_table}"
+
+// 实体可以实现该接口提供表名，_ 字段上没有table标签时使用
+type Tabler interface {
+	TableName() string
+}
+
+// 表名只能由字母、数字、下划线组成，可以带schema
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// 校验表名，WithTable和ContextWithTable传入的表名会直接拼接到sql中，执行前必须校验
+func CheckTableName(table string) error {
+	if !tableNameRegexp.MatchString(table) {
+		return fmt.Errorf("非法的表名: %s", table)
+	}
+	return nil
+}
+
+// 从mapper中VodkaMapper的实体获取表名，实体没有实现Tabler时返回空
+func entityTableName(mapperValue reflect.Value) string {
+	insertOneField, ok := mapperValue.Elem().Type().FieldByName("InsertOne")
+	if !ok || insertOneField.Type.Kind() != reflect.Func || insertOneField.Type.NumIn() == 0 {
+		return ""
+	}
+	entityType := insertOneField.Type.In(0)
+	if entityType.Kind() != reflect.Ptr {
+		return ""
+	}
+	if tabler, ok := reflect.New(entityType.Elem()).Interface().(Tabler); ok {
+		return tabler.TableName()
+	}
+	return ""
+}
+
+// 当前协程中替换的表名，key为声明的表名，value为实际使用的表名
+var tableLocal = util.NewThreadLocal(false)
+
+type tableContextKey struct{}
+
+// 在fn中执行的语句，表table替换为actual，可以嵌套，结束后恢复
+func WithTable(table, actual string, fn func()) {
+	previous, ok := tableLocal.Get()
+	overrides := map[string]string{}
+	if ok {
+		for k, v := range previous.(map[string]string) {
+			overrides[k] = v
+		}
+	}
+	overrides[table] = actual
+	tableLocal.Set(overrides)
+	defer func() {
+		if ok {
+			tableLocal.Set(previous)
+		} else {
+			tableLocal.Remove()
+		}
+	}()
+	fn()
+}
+
+// 返回一个新的ctx，在WithContext(ctx, fn)中执行的语句，表table替换为actual
+func ContextWithTable(ctx context.Context, table, actual string) context.Context {
+	overrides := map[string]string{}
+	if previous, ok := ctx.Value(tableContextKey{}).(map[string]string); ok {
+		for k, v := range previous {
+			overrides[k] = v
+		}
+	}
+	overrides[table] = actual
+	return context.WithValue(ctx, tableContextKey{}, overrides)
+}
+
+// 当前协程实际使用的表名，优先使用WithTable，其次是WithContext的ctx，都没有时为声明的表名
+func (m *MetaData) Table() string {
+	if overrides, ok := tableLocal.Get(); ok {
+		if actual, ok := overrides.(map[string]string)[m.TableName]; ok {
+			return actual
+		}
+	}
+	if overrides, ok := CurrentContext().Value(tableContextKey{}).(map[string]string); ok {
+		if actual, ok := overrides[m.TableName]; ok {
+			return actual
+		}
+	}
+	return m.TableName
+}
+
+// 执行前把当前的表名放入参数
+func bindTable(function *analyzer.Function, metadata *MetaData) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		table := metadata.Table()
+		if err := CheckTableName(table); err != nil {
+			return err
+		}
+		params["_table"] = table
+		return execute(resultWrappers, params)
+	}
+}
+
+// 返回使用表actual的副本，副本的方法在执行时把声明的表名替换为actual，原mapper不受影响
+//
+//	userMapper.WithTable("user_202410").SelectById(1)
+func (m *VodkaMapper[T, ID]) WithTable(actual string) *VodkaMapper[T, ID] {
+	scoped := *m
+	if m.metadata == nil {
+		return &scoped
+	}
+	table := m.metadata.TableName
+	value := reflect.ValueOf(&scoped).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.Func || field.IsNil() || !field.CanSet() {
+			continue
+		}
+		original := reflect.ValueOf(field.Interface())
+		field.Set(reflect.MakeFunc(field.Type(), func(args []reflect.Value) (results []reflect.Value) {
+			WithTable(table, actual, func() {
+				if original.Type().IsVariadic() {
+					results = original.CallSlice(args)
+				} else {
+					results = original.Call(args)
+				}
+			})
+			return results
+		}))
+	}
+	return &scoped
+}
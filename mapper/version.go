@@ -0,0 +1,96 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"vodka/analyzer"
+	"vodka/util"
+)
+
+// 乐观锁冲突，可以使用 errors.Is(err, ErrStaleObject) 判断
+var ErrStaleObject = errors.New("乐观锁冲突")
+
+// 按版本号更新时没有影响任何行，数据已被修改或已被删除
+type StaleObjectError struct {
+	Table   string
+	Version interface{} // 更新时使用的版本号
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("乐观锁冲突: 表 %s 中版本号为 %v 的数据已被修改或删除", e.Table, e.Version)
+}
+
+func (e *StaleObjectError) Is(target error) bool {
+	return target == ErrStaleObject
+}
+
+// 乐观锁的版本号列，在vo标签中使用version声明，如 vo:"version,version"
+type VersionLock struct {
+	Column string
+	index  []int
+}
+
+// 从实体的字段中找到版本号列，最多只能有一个，只能是整数类型
+func parseVersionLock(fields []reflect.StructField) (*VersionLock, error) {
+	var versionLock *VersionLock
+	for _, field := range fields {
+		voTag := util.ParseVoTag(field.Tag.Get("vo"))
+		if !voTag.Has("version") {
+			continue
+		}
+		if versionLock != nil {
+			return nil, fmt.Errorf("版本号列只能有一个: %s, %s", versionLock.Column, voTag.Name)
+		}
+		if !isIntegerKind(field.Type.Kind()) {
+			return nil, fmt.Errorf("版本号列 %s 必须是整数类型", voTag.Name)
+		}
+		versionLock = &VersionLock{Column: voTag.Name, index: field.Index}
+	}
+	return versionLock, nil
+}
+
+// 更新时set中的自增语句
+func (v *VersionLock) increment() string {
+	if v == nil {
+		return ""
+	}
+	return v.Column + " = " + v.Column + " + 1,"
+}
+
+// 更新时where中的版本号条件
+func (v *VersionLock) condition() string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf(" and %s = #{%s}", v.Column, v.Column)
+}
+
+// 按id更新时，没有影响任何行返回StaleObjectError，成功时将实体的版本号加1
+func (v *VersionLock) bind(function *analyzer.Function, table string) {
+	execute := function.Func
+	function.Func = func(resultWrappers []interface{}, params map[string]interface{}) error {
+		entity := reflect.ValueOf(params["params"])
+		if entity.Kind() != reflect.Ptr || entity.IsNil() {
+			return execute(resultWrappers, params)
+		}
+		version := entity.Elem().FieldByIndex(v.index)
+		current := version.Interface()
+		if err := execute(resultWrappers, params); err != nil {
+			return err
+		}
+		if affected, ok := resultWrappers[0].(*int64); ok && *affected == 0 {
+			return &StaleObjectError{Table: table, Version: current}
+		}
+		v.bump(version)
+		return nil
+	}
+}
+
+func (v *VersionLock) bump(version reflect.Value) {
+	if version.CanInt() {
+		version.SetInt(version.Int() + 1)
+	} else {
+		version.SetUint(version.Uint() + 1)
+	}
+}
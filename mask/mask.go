@@ -0,0 +1,77 @@
+package mask
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 脱敏函数，输入原值，返回脱敏后的值
+type Func func(value string) string
+
+// 是否需要脱敏，一般从ctx中读取调用者的角色，column为列名
+type Decider func(ctx context.Context, column string) bool
+
+var (
+	functions   = sync.Map{}
+	deciderLock sync.RWMutex
+	decider     Decider
+)
+
+func init() {
+	Register("phone", Phone)
+	Register("email", Email)
+}
+
+// 注册脱敏函数，在字段上使用 mask:"custom=name" 引用，同名的会被覆盖
+func Register(name string, fn Func) {
+	functions.Store(name, fn)
+}
+
+// 设置是否需要脱敏的判断，没有设置时不脱敏
+func SetDecider(fn Decider) {
+	deciderLock.Lock()
+	defer deciderLock.Unlock()
+	decider = fn
+}
+
+// 当前调用者的列column是否需要脱敏
+func ShouldMask(ctx context.Context, column string) bool {
+	deciderLock.RLock()
+	defer deciderLock.RUnlock()
+	return decider != nil && decider(ctx, column)
+}
+
+// 按mask标签查找脱敏函数，如 phone、email、custom=name
+func Lookup(rule string) (Func, error) {
+	name := rule
+	if custom, ok := strings.CutPrefix(rule, "custom="); ok {
+		name = custom
+	}
+	fn, ok := functions.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("脱敏规则 %s 不存在", rule)
+	}
+	return fn.(Func), nil
+}
+
+// 手机号保留前3位和后4位，如 138****1234，长度不足时全部替换
+func Phone(value string) string {
+	runes := []rune(value)
+	if len(runes) < 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:3]) + strings.Repeat("*", len(runes)-7) + string(runes[len(runes)-4:])
+}
+
+// 邮箱保留第一个字符和域名，如 a****@example.com
+func Email(value string) string {
+	local, domain, ok := strings.Cut(value, "@")
+	if !ok || local == "" {
+		return strings.Repeat("*", utf8.RuneCountInString(value))
+	}
+	first, _ := utf8.DecodeRuneInString(local)
+	return string(first) + "****@" + domain
+}
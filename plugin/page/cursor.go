@@ -0,0 +1,211 @@
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"vodka/database"
+	"vodka/runner"
+)
+
+// Cursor 游标分页（keyset分页）
+// 与Page不同，Cursor不使用 limit offset,size，而是记住上一页最后一行的排序键，
+// 下一页直接用 where (k1, k2) < (?, ?) 定位，翻到多深都只扫描一页的数据
+type Cursor[T any] struct {
+	Keys    []string // 排序键，最后一个必须能唯一确定一行，如 created_at,id
+	Desc    bool     // 是否倒序，所有排序键方向一致
+	Size    int64    // 每页条数
+	After   string   // 上一页返回的Next，为空表示第一页
+	Next    string   // 下一页的游标，没有更多数据时为空
+	HasMore bool     // 是否还有下一页
+	List    []*T
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 游标中每个值都带上类型，保证解码后以原类型绑定到sql中
+type cursorValue struct {
+	T string `json:"t"`
+	V string `json:"v"`
+}
+
+type cursorQuerier interface {
+	queryCursor(db database.Executor, query string, args []interface{}, dest []interface{}) error
+}
+
+func DoCursor[T any](cursor *Cursor[T], fun func()) error {
+	ThreadLocal.Set(cursor)
+	defer ThreadLocal.Remove()
+	fun()
+	return nil
+}
+
+// 判断当前分页上下文是否为游标分页
+func IsCursor(pg interface{}) bool {
+	_, ok := pg.(cursorQuerier)
+	return ok
+}
+
+func QueryCursor(db database.Executor, query string, args []interface{}, dest []interface{}, _cursor interface{}) error {
+	cursor, ok := _cursor.(cursorQuerier)
+	if !ok {
+		return errors.New("_cursor must be a pointer to a Cursor struct")
+	}
+	return cursor.queryCursor(db, query, args, dest)
+}
+
+func (c *Cursor[T]) queryCursor(db database.Executor, query string, args []interface{}, dest []interface{}) error {
+	if len(c.Keys) == 0 {
+		return errors.New("游标分页必须指定排序键")
+	}
+	for _, key := range c.Keys {
+		if !identifierRegexp.MatchString(key) {
+			return fmt.Errorf("非法的排序键: %s", key)
+		}
+	}
+	if c.Size <= 0 {
+		c.Size = 10
+	}
+	direction, op := "", ">"
+	if c.Desc {
+		direction, op = " desc", "<"
+	}
+
+	var builder strings.Builder
+	builder.WriteString("select * from (" + query + ") as t")
+	if c.After != "" {
+		values, err := DecodeCursor(c.After)
+		if err != nil {
+			return err
+		}
+		if len(values) != len(c.Keys) {
+			return errors.New("游标与排序键个数不匹配")
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+		builder.WriteString(fmt.Sprintf(" where (%s) %s (%s)", strings.Join(c.Keys, ","), op, placeholders))
+		args = append(args, values...)
+	}
+	orders := make([]string, len(c.Keys))
+	for i, key := range c.Keys {
+		orders[i] = key + direction
+	}
+	builder.WriteString(" order by " + strings.Join(orders, ","))
+	// 多查一条，用来判断是否还有下一页
+	builder.WriteString(" limit ?")
+	args = append(args, c.Size+1)
+	log.Println("游标分页sql:", builder.String())
+
+	if err := database.QueryStruct(db, builder.String(), args, dest); err != nil {
+		return err
+	}
+
+	c.List, c.Next, c.HasMore = nil, "", false
+	for _, v := range dest {
+		destValue := reflect.ValueOf(v)
+		if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+			continue
+		}
+		list := destValue.Elem()
+		if int64(list.Len()) > c.Size {
+			list = list.Slice(0, int(c.Size))
+			destValue.Elem().Set(list)
+			c.HasMore = true
+		}
+		if items, ok := list.Interface().([]*T); ok {
+			c.List = items
+		}
+		if c.HasMore {
+			last := list.Index(list.Len() - 1).Interface()
+			values := make([]interface{}, len(c.Keys))
+			for i, key := range c.Keys {
+				values[i] = runner.GetValue(key, last)
+				if values[i] == nil {
+					return fmt.Errorf("排序键 %s 在结果中不存在", key)
+				}
+			}
+			next, err := EncodeCursor(values)
+			if err != nil {
+				return err
+			}
+			c.Next = next
+		}
+		break
+	}
+	return nil
+}
+
+// 将排序键的值编码为不透明的游标
+func EncodeCursor(values []interface{}) (string, error) {
+	items := make([]cursorValue, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			items[i] = cursorValue{T: "t", V: v.Format(time.RFC3339Nano)}
+		case []byte:
+			items[i] = cursorValue{T: "b", V: base64.StdEncoding.EncodeToString(v)}
+		case string:
+			items[i] = cursorValue{T: "s", V: v}
+		default:
+			rv := reflect.ValueOf(value)
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				items[i] = cursorValue{T: "i", V: strconv.FormatInt(rv.Int(), 10)}
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				items[i] = cursorValue{T: "u", V: strconv.FormatUint(rv.Uint(), 10)}
+			case reflect.Float32, reflect.Float64:
+				items[i] = cursorValue{T: "f", V: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}
+			case reflect.String:
+				items[i] = cursorValue{T: "s", V: rv.String()}
+			default:
+				return "", fmt.Errorf("无法编码的游标类型 %T", value)
+			}
+		}
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// 解码EncodeCursor生成的游标
+func DecodeCursor(token string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("非法的游标")
+	}
+	var items []cursorValue
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, errors.New("非法的游标")
+	}
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		switch item.T {
+		case "t":
+			values[i], err = time.Parse(time.RFC3339Nano, item.V)
+		case "b":
+			values[i], err = base64.StdEncoding.DecodeString(item.V)
+		case "s":
+			values[i] = item.V
+		case "i":
+			values[i], err = strconv.ParseInt(item.V, 10, 64)
+		case "u":
+			values[i], err = strconv.ParseUint(item.V, 10, 64)
+		case "f":
+			values[i], err = strconv.ParseFloat(item.V, 64)
+		default:
+			err = fmt.Errorf("未知的游标类型 %s", item.T)
+		}
+		if err != nil {
+			return nil, errors.New("非法的游标")
+		}
+	}
+	return values, nil
+}
@@ -1,9 +1,7 @@
 package page
 
 import (
-	"database/sql"
 	"errors"
-	"fmt"
 	"log"
 	"reflect"
 	"vodka/database"
@@ -15,7 +13,8 @@ type Page[T any] struct {
 	PageSize   int64
 	TotalRows  int64
 	TotalPages int64
-	Sort       string
+	Sort       []Order
+	Sortable   []string // 允许排序的列，为空时使用T中vo标签声明的列
 	List       []*T
 }
 
@@ -65,9 +64,9 @@ func GetPageContext() interface{} {
 	//return page
 }
 
-func SelectTotal(db *sql.DB, sql string, args ...interface{}) (int64, error) {
+func SelectTotal(db database.Executor, sql string, args ...interface{}) (int64, error) {
 	sql = "select count(*) from (" + sql + ") t"
-	rows, err := db.Query(sql, args...)
+	rows, err := database.Query(db, sql, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -78,7 +77,7 @@ func SelectTotal(db *sql.DB, sql string, args ...interface{}) (int64, error) {
 	return total, nil
 }
 
-func QueryPage(db *sql.DB, query string, args []interface{}, dest []interface{}, _pg interface{}) error {
+func QueryPage(db database.Executor, query string, args []interface{}, dest []interface{}, _pg interface{}) error {
 	// page := GetPageContext[T]()
 	// 使用反射获取泛型类型
 	pgValue := reflect.ValueOf(_pg)
@@ -93,7 +92,16 @@ func QueryPage(db *sql.DB, query string, args []interface{}, dest []interface{},
 	pageSize := pgValue.Elem().FieldByName("PageSize")
 	totalRows := pgValue.Elem().FieldByName("TotalRows")
 	list := pgValue.Elem().FieldByName("List")
-	sort := pgValue.Elem().FieldByName("Sort")
+	sort, _ := pgValue.Elem().FieldByName("Sort").Interface().([]Order)
+	sortable, _ := pgValue.Elem().FieldByName("Sortable").Interface().([]string)
+	if len(sortable) == 0 {
+		// List的类型为[]*T
+		sortable = Columns(list.Type().Elem().Elem())
+	}
+	orderBy, err := BuildOrderBy(sort, sortable)
+	if err != nil {
+		return err
+	}
 
 	// pageNum最小值为1
 	if pageNum.Int() < 1 {
@@ -113,7 +121,7 @@ func QueryPage(db *sql.DB, query string, args []interface{}, dest []interface{},
 	totalPages := (total + pageSize.Int() - 1) / pageSize.Int()
 	pgValue.Elem().FieldByName("TotalPages").SetInt(totalPages)
 	// 重新拼装sql语句
-	sql := fmt.Sprintf("select * from ("+query+") as t order by %s limit ?,?", sort.String())
+	sql := "select * from (" + query + ") as t" + orderBy + " limit ?,?"
 	log.Println("分页sql:", sql)
 	offset := (pageNum.Int() - 1) * pageSize.Int()
 	args = append(args, offset, pageSize.Int())
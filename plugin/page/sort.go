@@ -0,0 +1,109 @@
+package page
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"vodka/util"
+)
+
+// 单个排序条件
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// 通过请求创建分页时，每页条数的上限
+var MaxPageSize int64 = 500
+
+// 解析形如 age,-id 的排序参数，-表示倒序
+func ParseSort(sort string) []Order {
+	var orders []Order
+	for _, item := range strings.Split(sort, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		order := Order{Column: item}
+		if strings.HasPrefix(item, "-") {
+			order = Order{Column: strings.TrimSpace(item[1:]), Desc: true}
+		} else if strings.HasPrefix(item, "+") {
+			order.Column = strings.TrimSpace(item[1:])
+		}
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// 根据白名单生成order by子句，没有排序条件时返回空字符串
+func BuildOrderBy(orders []Order, sortable []string) (string, error) {
+	if len(orders) == 0 {
+		return "", nil
+	}
+	allowed := make(map[string]bool, len(sortable))
+	for _, column := range sortable {
+		allowed[column] = true
+	}
+	items := make([]string, 0, len(orders))
+	for _, order := range orders {
+		// 白名单中的列一定是合法的标识符，这里再校验一次，防止白名单本身被污染
+		if !allowed[order.Column] || !identifierRegexp.MatchString(order.Column) {
+			return "", fmt.Errorf("列 %s 不允许排序", order.Column)
+		}
+		if order.Desc {
+			items = append(items, order.Column+" desc")
+		} else {
+			items = append(items, order.Column+" asc")
+		}
+	}
+	return " order by " + strings.Join(items, ","), nil
+}
+
+// 获取结构体中vo标签声明的列，没有vo标签的字段不能排序
+func Columns(structType reflect.Type) []string {
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil
+	}
+	var columns []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() || util.VoIgnored(field.Tag.Get("vo")) {
+			continue
+		}
+		if column := util.VoName(field.Tag.Get("vo")); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// 从请求参数 ?page=2&size=20&sort=age,-id 中创建分页
+// 排序列会按T中声明的列进行校验，非法的参数直接返回错误，可以直接作为400响应
+func FromRequest[T any](r *http.Request) (*Page[T], error) {
+	query := r.URL.Query()
+	pg := &Page[T]{PageNum: 1, PageSize: 10}
+	if value := query.Get("page"); value != "" {
+		pageNum, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || pageNum < 1 {
+			return nil, fmt.Errorf("非法的页码: %s", value)
+		}
+		pg.PageNum = pageNum
+	}
+	if value := query.Get("size"); value != "" {
+		pageSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || pageSize < 1 {
+			return nil, fmt.Errorf("非法的每页条数: %s", value)
+		}
+		pg.PageSize = min(pageSize, MaxPageSize)
+	}
+	pg.Sort = ParseSort(query.Get("sort"))
+	if _, err := BuildOrderBy(pg.Sort, Columns(reflect.TypeOf((*T)(nil)))); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
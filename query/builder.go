@@ -0,0 +1,303 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"vodka/analyzer"
+	"vodka/database"
+	"vodka/encrypt"
+	"vodka/mapper"
+	"vodka/plugin/page"
+)
+
+// 排序方向
+type Direction int
+
+const (
+	Asc Direction = iota
+	Desc
+)
+
+// 查询构造器，T为VodkaMapper的实体类型，表名取自实体所在的VodkaMapper
+// 生成的sql和xml中的语句一样，通过analyzer执行，在事务、分页插件中同样生效
+type Builder[T any] struct {
+	conditions []Condition
+	orders     []page.Order
+	limit      int64
+	offset     int64
+}
+
+func New[T any]() *Builder[T] {
+	return &Builder[T]{}
+}
+
+// 添加条件，多次调用时用and连接
+func (b *Builder[T]) Where(conditions ...Condition) *Builder[T] {
+	b.conditions = append(b.conditions, conditions...)
+	return b
+}
+
+// 同Where
+func (b *Builder[T]) And(conditions ...Condition) *Builder[T] {
+	return b.Where(conditions...)
+}
+
+func (b *Builder[T]) OrderBy(column string, direction Direction) *Builder[T] {
+	b.orders = append(b.orders, page.Order{Column: column, Desc: direction == Desc})
+	return b
+}
+
+// 最多返回的行数，0表示不限制
+func (b *Builder[T]) Limit(limit int64) *Builder[T] {
+	b.limit = limit
+	return b
+}
+
+// 跳过的行数，只有设置了Limit时才生效
+func (b *Builder[T]) Offset(offset int64) *Builder[T] {
+	b.offset = offset
+	return b
+}
+
+// 查询列表
+func (b *Builder[T]) Select() ([]*T, error) {
+	var list []*T
+	err := b.execute("Select", "SELECT", func(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) error {
+		builder.WriteString("select " + strings.Join(metadata.Tags, ",") + " from " + metadata.Table())
+		return b.buildQuery(builder, args, metadata, columns, b.limit)
+	}, []interface{}{&list})
+	return list, err
+}
+
+// 查询第一条，没有数据时返回nil
+func (b *Builder[T]) One() (*T, error) {
+	var list []*T
+	err := b.execute("One", "SELECT", func(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) error {
+		builder.WriteString("select " + strings.Join(metadata.Tags, ",") + " from " + metadata.Table())
+		return b.buildQuery(builder, args, metadata, columns, 1)
+	}, []interface{}{&list})
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// 查询总数，忽略排序和分页
+func (b *Builder[T]) Count() (int64, error) {
+	metadata, columns, err := b.metadata()
+	if err != nil {
+		return 0, err
+	}
+	var builder strings.Builder
+	args := make([]interface{}, 0)
+	builder.WriteString("select count(*) from " + metadata.Table())
+	if _, err := b.buildWhere(&builder, &args, metadata, columns); err != nil {
+		return 0, err
+	}
+	log.Printf("【%s】【Count】 sql : %s %v", metadata.TableName, builder.String(), args)
+	// count不受分页插件影响
+	var total int64
+	err = database.QueryStruct(analyzer.CurrentExecutor(), builder.String(), args, []interface{}{&total})
+	return total, err
+}
+
+// 更新符合条件的行，values的key为列名，必须至少有一个条件
+// 和UpdateById一样填充update的列并校验被更新的列；条件中有版本号的Eq时，没有影响任何行返回StaleObjectError
+// 没有实体可以调用回调，实体实现了BeforeUpdate、AfterUpdate时返回错误
+func (b *Builder[T]) Update(values map[string]interface{}) (int64, error) {
+	if len(values) == 0 {
+		return 0, errors.New("没有需要更新的列")
+	}
+	var affected int64
+	var table, versionColumn string
+	err := b.execute("Update", "UPDATE", func(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) error {
+		entity := new(T)
+		if mapper.HasWriteHook("UPDATE", entity) {
+			return fmt.Errorf("实体 %T 实现了更新的回调，查询构造器的Update不会调用回调，请使用UpdateById等方法", entity)
+		}
+		values, err := mapper.PrepareUpdateValues(metadata, entity, values)
+		if err != nil {
+			return err
+		}
+		if metadata.VersionLock != nil {
+			table, versionColumn = metadata.TableName, metadata.VersionLock.Column
+		}
+		allowed := columnSet(columns)
+		// 只读的列和只在插入时写入的列不能更新
+		for column := range allowed {
+			if metadata.IsReadOnly(column) || metadata.IsInsertOnly(column) {
+				delete(allowed, column)
+			}
+		}
+		// 逻辑删除列只能通过Delete修改，版本号列自动加1
+		if metadata.LogicDelete != nil {
+			delete(allowed, metadata.LogicDelete.Column)
+		}
+		if metadata.VersionLock != nil {
+			delete(allowed, metadata.VersionLock.Column)
+		}
+		// 列按名称排序，保证相同的更新生成相同的sql
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			if err := checkColumn(key, allowed); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		builder.WriteString("update " + metadata.Table() + " set ")
+		if versionLock := metadata.VersionLock; versionLock != nil {
+			builder.WriteString(versionLock.Column + " = " + versionLock.Column + " + 1,")
+		}
+		for i, key := range keys {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(key + " = ?")
+			value := values[key]
+			// 加密的列写入密文
+			if deterministic, ok := metadata.Columns.Encrypt[key]; ok {
+				encrypted, err := encrypt.Value(value, deterministic)
+				if err != nil {
+					return err
+				}
+				value = encrypted
+			}
+			*args = append(*args, value)
+		}
+		// 按渲染出的有效条件判断，Where(And())、Where(NotIn("id", []int{}))这类恒成立的条件同样会被拒绝
+		predicates, err := b.buildWhere(builder, args, metadata, columns)
+		if err == nil && predicates == 0 {
+			return errors.New("更新必须指定条件")
+		}
+		return err
+	}, []interface{}{&affected})
+	if err == nil && affected == 0 && versionColumn != "" {
+		if version, ok := versionCondition(b.conditions, versionColumn); ok {
+			return 0, &mapper.StaleObjectError{Table: table, Version: version}
+		}
+	}
+	return affected, err
+}
+
+// 顶层条件中版本号列的等值条件
+func versionCondition(conditions []Condition, column string) (interface{}, bool) {
+	for _, condition := range conditions {
+		if c, ok := condition.(*compare); ok && c.column == column && c.op == "=" {
+			return c.value, true
+		}
+	}
+	return nil, false
+}
+
+// 删除符合条件的行，必须至少有一个条件
+// 没有实体可以调用回调，实体实现了BeforeDelete、AfterDelete时返回错误
+func (b *Builder[T]) Delete() (int64, error) {
+	var affected int64
+	err := b.execute("Delete", "DELETE", func(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) error {
+		if entity := new(T); mapper.HasWriteHook("DELETE", entity) {
+			return fmt.Errorf("实体 %T 实现了删除的回调，查询构造器的Delete不会调用回调，请先查询出实体再使用DeleteByCondition", entity)
+		}
+		if logicDelete := metadata.LogicDelete; logicDelete != nil && !mapper.IsUnscoped() {
+			// 逻辑删除改为更新逻辑删除列
+			if logicDelete.Timestamp {
+				builder.WriteString("update " + metadata.Table() + " set " + logicDelete.Column + " = ?")
+				*args = append(*args, time.Now())
+			} else {
+				builder.WriteString("update " + metadata.Table() + " set " + logicDelete.Column + " = " + logicDelete.DeletedValue)
+			}
+		} else {
+			builder.WriteString("delete from " + metadata.Table())
+		}
+		predicates, err := b.buildWhere(builder, args, metadata, columns)
+		if err == nil && predicates == 0 {
+			return errors.New("删除必须指定条件")
+		}
+		return err
+	}, []interface{}{&affected})
+	return affected, err
+}
+
+func (b *Builder[T]) execute(name string, statementType string, build func(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) error, resultWrappers []interface{}) error {
+	metadata, columns, err := b.metadata()
+	if err != nil {
+		return err
+	}
+	var builder strings.Builder
+	args := make([]interface{}, 0)
+	if err := build(&builder, &args, metadata, columns); err != nil {
+		return err
+	}
+	log.Printf("【%s】【%s】 sql : %s %v", metadata.TableName, name, builder.String(), args)
+	if err := analyzer.Execute(statementType, builder.String(), args, resultWrappers); err != nil {
+		return err
+	}
+	// 查询结果和mapper的方法一样脱敏并调用实体的AfterFind
+	if statementType == "SELECT" {
+		return mapper.AfterQuery(resultWrappers)
+	}
+	return nil
+}
+
+// 实体对应的表信息和列
+func (b *Builder[T]) metadata() (*mapper.MetaData, []string, error) {
+	entityType := reflect.TypeOf((*T)(nil)).Elem()
+	metadata, ok := mapper.GetEntityMetaData(entityType)
+	if !ok {
+		return nil, nil, fmt.Errorf("实体 %s 没有对应的VodkaMapper，请先InitMapper", entityType)
+	}
+	if err := mapper.CheckTableName(metadata.Table()); err != nil {
+		return nil, nil, err
+	}
+	return metadata, page.Columns(entityType), nil
+}
+
+// 声明了逻辑删除列时，不在Unscoped中的语句会附加未删除的条件
+// 返回调用方写入的有效条件数，不包括逻辑删除的条件
+func (b *Builder[T]) buildWhere(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string) (int, error) {
+	conditions, err := encryptConditions(b.conditions, metadata.Columns.Encrypt)
+	if err != nil {
+		return 0, err
+	}
+	if metadata.LogicDelete != nil && !mapper.IsUnscoped() {
+		conditions = append(conditions[:len(conditions):len(conditions)], raw(metadata.LogicDelete.Condition()))
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+	builder.WriteString(" where ")
+	return And(conditions...).build(builder, args, columnSet(columns))
+}
+
+func (b *Builder[T]) buildQuery(builder *strings.Builder, args *[]interface{}, metadata *mapper.MetaData, columns []string, limit int64) error {
+	if _, err := b.buildWhere(builder, args, metadata, columns); err != nil {
+		return err
+	}
+	orderBy, err := page.BuildOrderBy(b.orders, columns)
+	if err != nil {
+		return err
+	}
+	builder.WriteString(orderBy)
+	if limit > 0 {
+		builder.WriteString(" limit ?")
+		*args = append(*args, limit)
+		if b.offset > 0 {
+			builder.WriteString(" offset ?")
+			*args = append(*args, b.offset)
+		}
+	}
+	return nil
+}
+
+func columnSet(columns []string) map[string]bool {
+	set := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		set[column] = true
+	}
+	return set
+}
@@ -0,0 +1,304 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"vodka/database"
+	"vodka/runner"
+)
+
+// 查询条件，列名在执行时根据实体的vo标签校验
+// build返回写入的有效条件数，恒成立的条件（如空的And、空集合的NotIn）为0，Update和Delete据此拒绝没有条件的语句
+type Condition interface {
+	build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error)
+}
+
+func checkColumn(column string, columns map[string]bool) error {
+	if !columns[column] {
+		return fmt.Errorf("实体中不存在列 %s", column)
+	}
+	return nil
+}
+
+// ---------------------- 比较 ----------------------
+
+type compare struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+func (c *compare) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	if err := checkColumn(c.column, columns); err != nil {
+		return 0, err
+	}
+	builder.WriteString(c.column + " " + c.op + " ?")
+	*args = append(*args, c.value)
+	return 1, nil
+}
+
+// column = value
+func Eq(column string, value interface{}) Condition {
+	return &compare{column: column, op: "=", value: value}
+}
+
+// column <> value
+func Ne(column string, value interface{}) Condition {
+	return &compare{column: column, op: "<>", value: value}
+}
+
+// column > value
+func Gt(column string, value interface{}) Condition {
+	return &compare{column: column, op: ">", value: value}
+}
+
+// column >= value
+func Ge(column string, value interface{}) Condition {
+	return &compare{column: column, op: ">=", value: value}
+}
+
+// column < value
+func Lt(column string, value interface{}) Condition {
+	return &compare{column: column, op: "<", value: value}
+}
+
+// column <= value
+func Le(column string, value interface{}) Condition {
+	return &compare{column: column, op: "<=", value: value}
+}
+
+// ---------------------- like ----------------------
+
+type like struct {
+	column string
+	value  string
+	mode   string
+	not    bool
+}
+
+func (l *like) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	if err := checkColumn(l.column, columns); err != nil {
+		return 0, err
+	}
+	pattern := runner.EscapeLike(l.value)
+	switch l.mode {
+	case "left":
+		pattern = "%" + pattern
+	case "right":
+		pattern = pattern + "%"
+	default:
+		pattern = "%" + pattern + "%"
+	}
+	if l.not {
+		builder.WriteString(l.column + " not like ?")
+	} else {
+		builder.WriteString(l.column + " like ?")
+	}
+	builder.WriteString(database.GetDialect().LikeEscape())
+	*args = append(*args, pattern)
+	return 1, nil
+}
+
+// column like '%value%'，value中的通配符会被转义
+func Like(column string, value string) Condition {
+	return &like{column: column, value: value, mode: "both"}
+}
+
+// column not like '%value%'
+func NotLike(column string, value string) Condition {
+	return &like{column: column, value: value, mode: "both", not: true}
+}
+
+// column like '%value'
+func LikeLeft(column string, value string) Condition {
+	return &like{column: column, value: value, mode: "left"}
+}
+
+// column like 'value%'
+func LikeRight(column string, value string) Condition {
+	return &like{column: column, value: value, mode: "right"}
+}
+
+// ---------------------- in ----------------------
+
+type in struct {
+	column string
+	values interface{}
+	not    bool
+}
+
+func (i *in) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	if err := checkColumn(i.column, columns); err != nil {
+		return 0, err
+	}
+	values := reflect.ValueOf(i.values)
+	if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+		return 0, fmt.Errorf("列 %s 的in条件必须是切片", i.column)
+	}
+	// 空集合：in永远不成立，not in永远成立，不算作有效条件
+	if values.Len() == 0 {
+		if i.not {
+			builder.WriteString("1 = 1")
+			return 0, nil
+		}
+		builder.WriteString("1 = 0")
+		return 1, nil
+	}
+	builder.WriteString(i.column)
+	if i.not {
+		builder.WriteString(" not")
+	}
+	builder.WriteString(" in (")
+	for index := 0; index < values.Len(); index++ {
+		if index > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("?")
+		*args = append(*args, values.Index(index).Interface())
+	}
+	builder.WriteString(")")
+	return 1, nil
+}
+
+// column in (values...)，values为切片，为空时不匹配任何行
+func In(column string, values interface{}) Condition {
+	return &in{column: column, values: values}
+}
+
+// column not in (values...)，values为切片，为空时匹配所有行
+func NotIn(column string, values interface{}) Condition {
+	return &in{column: column, values: values, not: true}
+}
+
+// ---------------------- between ----------------------
+
+type between struct {
+	column string
+	from   interface{}
+	to     interface{}
+	not    bool
+}
+
+func (b *between) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	if err := checkColumn(b.column, columns); err != nil {
+		return 0, err
+	}
+	if b.not {
+		builder.WriteString(b.column + " not between ? and ?")
+	} else {
+		builder.WriteString(b.column + " between ? and ?")
+	}
+	*args = append(*args, b.from, b.to)
+	return 1, nil
+}
+
+// column between from and to
+func Between(column string, from, to interface{}) Condition {
+	return &between{column: column, from: from, to: to}
+}
+
+// column not between from and to
+func NotBetween(column string, from, to interface{}) Condition {
+	return &between{column: column, from: from, to: to, not: true}
+}
+
+// ---------------------- null ----------------------
+
+type null struct {
+	column string
+	not    bool
+}
+
+func (n *null) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	if err := checkColumn(n.column, columns); err != nil {
+		return 0, err
+	}
+	if n.not {
+		builder.WriteString(n.column + " is not null")
+	} else {
+		builder.WriteString(n.column + " is null")
+	}
+	return 1, nil
+}
+
+// column is null
+func IsNull(column string) Condition {
+	return &null{column: column}
+}
+
+// column is not null
+func IsNotNull(column string) Condition {
+	return &null{column: column, not: true}
+}
+
+// ---------------------- raw ----------------------
+
+// 框架内部生成的条件，不校验列名，也不算作调用方的条件
+type raw string
+
+func (r raw) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	builder.WriteString(string(r))
+	return 0, nil
+}
+
+// ---------------------- and / or ----------------------
+
+type group struct {
+	conjunction string
+	conditions  []Condition
+}
+
+func (g *group) build(builder *strings.Builder, args *[]interface{}, columns map[string]bool) (int, error) {
+	written := 0
+	predicates := 0
+	always := false // or中有恒成立的条件时整体恒成立
+	for _, condition := range g.conditions {
+		if condition == nil {
+			continue
+		}
+		if written > 0 {
+			builder.WriteString(" " + g.conjunction + " ")
+		}
+		// 嵌套的分组加上括号
+		_, nested := condition.(*group)
+		if nested {
+			builder.WriteString("(")
+		}
+		count, err := condition.build(builder, args, columns)
+		if err != nil {
+			return 0, err
+		}
+		if nested {
+			builder.WriteString(")")
+		}
+		if _, internal := condition.(raw); count == 0 && !internal {
+			always = true
+		}
+		predicates += count
+		written++
+	}
+	if written == 0 {
+		// 空的and永远成立，空的or永远不成立
+		if g.conjunction == "and" {
+			builder.WriteString("1 = 1")
+			return 0, nil
+		}
+		builder.WriteString("1 = 0")
+		return 1, nil
+	}
+	if g.conjunction == "or" && always {
+		return 0, nil
+	}
+	return predicates, nil
+}
+
+// 所有条件都成立
+func And(conditions ...Condition) Condition {
+	return &group{conjunction: "and", conditions: conditions}
+}
+
+// 任意一个条件成立
+func Or(conditions ...Condition) Condition {
+	return &group{conjunction: "or", conditions: conditions}
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"vodka/encrypt"
+)
+
+// 加密条件中的值，只有确定性加密的列的等值条件（Eq、Ne、In、NotIn）可以匹配加密后的数据
+// 随机加密的列除了IsNull、IsNotNull以外不能作为条件，返回错误
+func encryptConditions(conditions []Condition, columns map[string]bool) ([]Condition, error) {
+	if len(columns) == 0 {
+		return conditions, nil
+	}
+	result := make([]Condition, 0, len(conditions))
+	for _, condition := range conditions {
+		if err := checkRandomColumn(condition, columns); err != nil {
+			return nil, err
+		}
+		switch c := condition.(type) {
+		case *compare:
+			if deterministic, ok := columns[c.column]; ok && deterministic && (c.op == "=" || c.op == "<>") {
+				value, err := encrypt.Value(c.value, true)
+				if err != nil {
+					return nil, err
+				}
+				condition = &compare{column: c.column, op: c.op, value: value}
+			}
+		case *in:
+			if deterministic, ok := columns[c.column]; ok && deterministic {
+				values := reflect.ValueOf(c.values)
+				if values.Kind() == reflect.Slice || values.Kind() == reflect.Array {
+					encrypted := make([]interface{}, values.Len())
+					for i := range encrypted {
+						value, err := encrypt.Value(values.Index(i).Interface(), true)
+						if err != nil {
+							return nil, err
+						}
+						encrypted[i] = value
+					}
+					condition = &in{column: c.column, values: encrypted, not: c.not}
+				}
+			}
+		case *group:
+			children, err := encryptConditions(c.conditions, columns)
+			if err != nil {
+				return nil, err
+			}
+			condition = &group{conjunction: c.conjunction, conditions: children}
+		}
+		result = append(result, condition)
+	}
+	return result, nil
+}
+
+// 随机加密的列每次加密的结果都不同，作为条件时永远查不到数据
+func checkRandomColumn(condition Condition, columns map[string]bool) error {
+	var column string
+	switch c := condition.(type) {
+	case *compare:
+		column = c.column
+	case *like:
+		column = c.column
+	case *in:
+		column = c.column
+	case *between:
+		column = c.column
+	default:
+		return nil
+	}
+	if deterministic, ok := columns[column]; ok && !deterministic {
+		return fmt.Errorf("列 %s 使用随机加密，不能作为条件，需要查询时请声明encrypt=deterministic", column)
+	}
+	return nil
+}
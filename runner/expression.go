@@ -1,12 +1,17 @@
 package runner
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
+	"vodka/encrypt"
 	"vodka/plugin"
+	"vodka/util"
 )
 
 // TokenType 定义
@@ -24,6 +29,7 @@ const (
 	Colon        TokenType = "Colon"
 
 	FunctionCall TokenType = "FunctionCall" // 新增函数调用类型
+	Comma        TokenType = "Comma"        // 函数参数的分隔符
 
 )
 
@@ -37,22 +43,41 @@ type ASTNode struct {
 	Value interface{}
 	Left  *ASTNode
 	Right *ASTNode
+	path  []string // Identifier预先拆分好的属性路径
 }
 type AST struct {
 	Root *ASTNode
 }
 
-func EvaluateExpression(expr string, params map[string]interface{}) interface{} {
+// 预编译后的表达式，词法分析和语法分析只做一次，之后可以并发的重复求值
+type Expression struct {
+	Source string
+	root   *ASTNode
+}
+
+// 编译表达式，表达式有误时返回错误
+func CompileExpression(expr string) (expression *Expression, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("表达式 %s 解析失败: %v", expr, r)
+		}
+	}()
 	// 词法分析
 	tokens := lexicalAnalysis(expr)
+	if len(tokens) == 0 {
+		return nil, errors.New("表达式不能为空")
+	}
 
 	// 语法分析和规约
 	ast := syntaxAnalysis(tokens)
 
 	//printAST(ast)
+	return &Expression{Source: expr, root: ast}, nil
+}
 
-	// 计算表达式
-	val := evaluateAST(ast, params)
+// 计算表达式
+func (e *Expression) Evaluate(params map[string]interface{}) interface{} {
+	val := evaluateAST(e.root, params)
 	valBool, ok := val.(bool)
 	if ok {
 		return valBool
@@ -60,6 +85,14 @@ func EvaluateExpression(expr string, params map[string]interface{}) interface{}
 	return val
 }
 
+func EvaluateExpression(expr string, params map[string]interface{}) interface{} {
+	expression, err := CompileExpression(expr)
+	if err != nil {
+		panic(err)
+	}
+	return expression.Evaluate(params)
+}
+
 func printAST(ast *ASTNode) {
 	if ast == nil {
 		return
@@ -152,6 +185,13 @@ func lexicalAnalysis(expr string) []Token {
 			}
 			tokens = append(tokens, Token{Type: Parenthesis, Value: string(char)})
 
+		case char == ',':
+			if currentToken != "" {
+				tokens = append(tokens, Token{Type: tokenType, Value: currentToken})
+				currentToken = ""
+			}
+			tokens = append(tokens, Token{Type: Comma, Value: string(char)})
+
 		// 三元表达式
 		case char == '?':
 			if currentToken != "" {
@@ -278,7 +318,10 @@ func parsePrimary(tokens []Token, pos *int) *ASTNode {
 			*pos++ // 跳过右括号
 			return &ASTNode{Type: "FunctionCall", Value: token.Value, Left: args}
 		}
-		return &ASTNode{Type: "Identifier", Value: token.Value}
+		if token.Value == "true" || token.Value == "false" {
+			return &ASTNode{Type: "Bool", Value: token.Value == "true"}
+		}
+		return &ASTNode{Type: "Identifier", Value: token.Value, path: SplitPath(token.Value)}
 		// return &ASTNode{Type: "Identifier", Value: token.Value}
 	case Integer:
 		value, _ := toInt64(token.Value)
@@ -368,7 +411,7 @@ func evaluateAST(ast *ASTNode, params map[string]interface{}) interface{} {
 			panic(fmt.Sprintf("不支持的操作符: %s", ast.Value))
 		}
 	case "Identifier":
-		value := GetValue(ast.Value.(string), params)
+		value := GetPathValue(ast.path, params)
 		return value
 	case "Integer":
 		return ast.Value
@@ -383,7 +426,7 @@ func evaluateAST(ast *ASTNode, params map[string]interface{}) interface{} {
 		// 	return num
 		// }
 		// return ast.Value
-	case "String":
+	case "String", "Bool":
 		return ast.Value
 	case "TernaryOp":
 		condition := evaluateAST(ast.Left, params)
@@ -517,8 +560,17 @@ func getValueFromMap(key string, params map[string]interface{}) interface{} {
 	return nil
 }
 
+// 拆分属性路径，如 user.name
+func SplitPath(key string) []string {
+	return strings.Split(key, ".")
+}
+
 func GetValue(key string, params interface{}) interface{} {
-	keys := strings.Split(key, ".")
+	return GetPathValue(SplitPath(key), params)
+}
+
+// 按预先拆分好的路径取值
+func GetPathValue(keys []string, params interface{}) interface{} {
 	value := params
 	for _, k := range keys {
 		switch v := value.(type) {
@@ -535,16 +587,19 @@ func GetValue(key string, params interface{}) interface{} {
 			if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
 				rv = rv.Elem()
 			}
-			if rv.Kind() == reflect.Struct {
+			if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+				// 切片按下标取值，如 range.0
+				index, err := strconv.Atoi(k)
+				if err != nil || index < 0 || index >= rv.Len() {
+					return nil
+				}
+				value = rv.Index(index).Interface()
+			} else if rv.Kind() == reflect.Struct {
 				// 优先尝试读取 vo 标签
-				field, found := rv.Type().FieldByNameFunc(func(fieldName string) bool {
-					field, _ := rv.Type().FieldByName(fieldName)
-					tag := field.Tag.Get("vo")
-					return tag == k || fieldName == k
-				})
+				index, found := fieldIndex(rv.Type(), k)
 
 				if found {
-					value = rv.FieldByIndex(field.Index).Interface()
+					value = FieldValue(rv.FieldByIndex(index))
 				} else {
 					return nil
 				}
@@ -556,6 +611,63 @@ func GetValue(key string, params interface{}) interface{} {
 	return value
 }
 
+// 按预先拆分好的路径查找结构体字段的标签，路径的最后一段不是结构体的字段时返回false
+func PathFieldTag(keys []string, params interface{}) (reflect.StructTag, bool) {
+	if len(keys) < 2 {
+		return "", false
+	}
+	rv := reflect.ValueOf(GetPathValue(keys[:len(keys)-1], params))
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return "", false
+	}
+	index, found := fieldIndex(rv.Type(), keys[len(keys)-1])
+	if !found {
+		return "", false
+	}
+	return rv.Type().FieldByIndex(index).Tag, true
+}
+
+// 字段的值，指向非结构体的指针字段取指向的值，nil指针返回nil，表示字段没有值
+func FieldValue(field reflect.Value) interface{} {
+	if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() != reflect.Struct {
+		if field.IsNil() {
+			return nil
+		}
+		return field.Elem().Interface()
+	}
+	return field.Interface()
+}
+
+type fieldKey struct {
+	structType reflect.Type
+	name       string
+}
+
+// 字段查找的缓存，key为结构体类型和属性名
+var fieldIndexCache sync.Map
+
+// 查找vo标签或字段名为name的字段，结果会被缓存
+func fieldIndex(structType reflect.Type, name string) ([]int, bool) {
+	key := fieldKey{structType: structType, name: name}
+	if index, ok := fieldIndexCache.Load(key); ok {
+		return index.([]int), index.([]int) != nil
+	}
+	field, found := structType.FieldByNameFunc(func(fieldName string) bool {
+		field, _ := structType.FieldByName(fieldName)
+		tag := util.VoName(field.Tag.Get("vo"))
+		return tag == name || fieldName == name
+	})
+	var index []int
+	if found {
+		index = field.Index
+	}
+	fieldIndexCache.Store(key, index)
+	return index, found
+}
+
 func parseArguments(tokens []Token, pos *int) *ASTNode {
 	var args []*ASTNode
 	for *pos < len(tokens) && tokens[*pos].Value != ")" {
@@ -577,9 +689,8 @@ func evaluateArguments(argsNode *ASTNode, params map[string]interface{}) []inter
 }
 
 func callFunction(name string, args []interface{}) interface{} {
-	if name == "_sum" {
-		// test
-		return _sum(args)
+	if builtin, ok := builtinFunctions[name]; ok {
+		return builtin(args)
 	}
 	handler, ok := plugin.GetFunctionHandler(name)
 	if !ok {
@@ -596,6 +707,141 @@ func callFunction(name string, args []interface{}) interface{} {
 	// }
 }
 
+// 内置函数，以_开头，不能被覆盖
+var builtinFunctions = map[string]func(args []interface{}) interface{}{
+	"_sum":      _sum,
+	"_len":      _len,
+	"_like":     _like,
+	"_range":    _range,
+	"_has":      _has,
+	"_contains": _contains,
+	"_now":      _now,
+	"_empty":    _empty,
+	"_encrypt":  _encrypt,
+}
+
+// 使用确定性加密加密参数，用于在xml中按加密的列等值查询，如 phone = #{_encrypt(phone)}
+func _encrypt(args []interface{}) interface{} {
+	if len(args) != 1 {
+		panic("encrypt 函数需要一个参数")
+	}
+	value, err := encrypt.Value(args[0], true)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// 判断值是否为nil或者类型的零值，如 0、空字符串、零值的time.Time
+func _empty(args []interface{}) interface{} {
+	if len(args) != 1 {
+		panic("empty 函数需要一个参数")
+	}
+	return args[0] == nil || reflect.ValueOf(args[0]).IsZero()
+}
+
+// 当前时间
+func _now(args []interface{}) interface{} {
+	if len(args) != 0 {
+		panic("now 函数没有参数")
+	}
+	return time.Now()
+}
+
+// 判断map中是否存在key，值为nil时同样返回true，map为nil时返回false
+func _has(args []interface{}) interface{} {
+	if len(args) != 2 {
+		panic("has 函数需要两个参数")
+	}
+	if args[0] == nil {
+		return false
+	}
+	value := reflect.ValueOf(args[0])
+	if value.Kind() != reflect.Map {
+		panic(fmt.Sprintf("has 函数不支持类型 %T", args[0]))
+	}
+	key := reflect.ValueOf(args[1])
+	if !key.IsValid() || !key.Type().AssignableTo(value.Type().Key()) {
+		return false
+	}
+	return value.MapIndex(key).IsValid()
+}
+
+// 判断集合中是否包含某个元素，集合为nil时返回false
+func _contains(args []interface{}) interface{} {
+	if len(args) != 2 {
+		panic("contains 函数需要两个参数")
+	}
+	if args[0] == nil {
+		return false
+	}
+	value := reflect.ValueOf(args[0])
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		panic(fmt.Sprintf("contains 函数不支持类型 %T", args[0]))
+	}
+	for i := 0; i < value.Len(); i++ {
+		if reflect.DeepEqual(value.Index(i).Interface(), args[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// 转义like中的通配符，转义字符为\
+func EscapeLike(value string) string {
+	return likeReplacer.Replace(value)
+}
+
+// like的匹配模式，转义%、_和\，第二个参数为left、right、both，表示通配符所在的位置
+func _like(args []interface{}) interface{} {
+	if len(args) != 2 {
+		panic("like 函数需要两个参数")
+	}
+	value := EscapeLike(fmt.Sprintf("%v", args[0]))
+	switch args[1] {
+	case "left":
+		return "%" + value
+	case "right":
+		return value + "%"
+	case "both":
+		return "%" + value + "%"
+	}
+	panic(fmt.Sprintf("like 函数不支持的模式: %v", args[1]))
+}
+
+// 判断是否为区间，nil返回false，两个元素的切片返回true，其他情况报错
+func _range(args []interface{}) interface{} {
+	if len(args) != 1 {
+		panic("range 函数只能有一个参数")
+	}
+	if args[0] == nil {
+		return false
+	}
+	value := reflect.ValueOf(args[0])
+	if (value.Kind() != reflect.Slice && value.Kind() != reflect.Array) || value.Len() != 2 {
+		panic(fmt.Sprintf("区间必须是两个元素的切片: %v", args[0]))
+	}
+	return true
+}
+
+// 集合、map或字符串的长度，nil的长度为0
+func _len(args []interface{}) interface{} {
+	if len(args) != 1 {
+		panic("len 函数只能有一个参数")
+	}
+	if args[0] == nil {
+		return 0
+	}
+	value := reflect.ValueOf(args[0])
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return value.Len()
+	}
+	panic(fmt.Sprintf("len 函数不支持类型 %T", args[0]))
+}
+
 func _sum(args []interface{}) interface{} {
 	var result float64
 	for _, arg := range args {
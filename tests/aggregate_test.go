@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Payment struct {
+	Id     int64   `vo:"id"`
+	UserId int64   `vo:"user_id"`
+	Status string  `vo:"status"`
+	Amount float64 `vo:"amount"`
+}
+
+type PaymentMapper struct {
+	mapper.VodkaMapper[Payment, int64]
+	_ struct{} `table:"payment" pk:"id"`
+}
+
+type PaymentReport struct {
+	UserId int64   `vo:"user_id"`
+	Total  float64 `vo:"total"`
+	Count  int64   `vo:"count"`
+}
+
+func TestAggregate(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	paymentMapper := &PaymentMapper{}
+	if err := vodka.InitMapper(paymentMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() fakeCall {
+		queries := fake.Queries()
+		return queries[len(queries)-1]
+	}
+	defer func() { fake.onQuery = nil }()
+
+	t.Run("聚合函数", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"value"}, [][]driver.Value{{"12.50"}}, nil
+		}
+		sum, err := paymentMapper.Sum("amount", map[string]interface{}{"EQ_status": "paid"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != 12.5 {
+			t.Errorf("sum错误: %v", sum)
+		}
+		call := lastQuery()
+		if query := normalizeSql(call.Query); query != "select sum(amount) from payment where status = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if !reflect.DeepEqual(call.Args, []driver.Value{"paid"}) {
+			t.Errorf("参数错误: %v", call.Args)
+		}
+
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"value"}, [][]driver.Value{{int64(3)}}, nil
+		}
+		count, err := paymentMapper.CountDistinct("user_id", map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("count错误: %v", count)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select count(distinct user_id) from payment" {
+			t.Errorf("sql错误: %s", query)
+		}
+		max, err := paymentMapper.Max("id", map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if max != int64(3) {
+			t.Errorf("max错误: %v", max)
+		}
+
+		// 没有数据时sum为NULL
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"value"}, [][]driver.Value{{nil}}, nil
+		}
+		if avg, err := paymentMapper.Avg("amount", map[string]interface{}{}); err != nil || avg != 0 {
+			t.Errorf("avg错误: %v %v", avg, err)
+		}
+		if min, err := paymentMapper.Min("amount", map[string]interface{}{}); err != nil || min != nil {
+			t.Errorf("min错误: %v %v", min, err)
+		}
+	})
+
+	t.Run("分组聚合", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"user_id", "total", "count"}, [][]driver.Value{{int64(1), "30.00", int64(2)}, {int64(2), "5.50", int64(1)}}, nil
+		}
+		rows, err := paymentMapper.GroupBy([]string{"user_id"}, []string{"sum(amount) as total", "count(*)"}, map[string]interface{}{"EQ_status": "paid"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[0]["user_id"] != int64(1) || rows[0]["total"] != "30.00" {
+			t.Errorf("查询结果错误: %v", rows)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select user_id,sum(amount) as total,count(*) as count from payment where status = ? group by user_id" {
+			t.Errorf("sql错误: %s", query)
+		}
+
+		reports, err := vodka.GroupByAs[PaymentReport](&paymentMapper.VodkaMapper, []string{"user_id"}, []string{"sum(amount) as total", "count(*)"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 2 || *reports[1] != (PaymentReport{UserId: 2, Total: 5.5, Count: 1}) {
+			t.Errorf("查询结果错误: %+v", reports)
+		}
+	})
+
+	t.Run("非法的列和聚合函数", func(t *testing.T) {
+		if _, err := paymentMapper.Sum("amount) from payment; --", map[string]interface{}{}); err == nil {
+			t.Error("非法的列应该返回错误")
+		}
+		if _, err := paymentMapper.GroupBy([]string{"user_id"}, []string{"sum(password)"}, map[string]interface{}{}); err == nil {
+			t.Error("实体中不存在的列应该返回错误")
+		}
+		if _, err := paymentMapper.GroupBy([]string{"user_id"}, []string{"sum(*)"}, map[string]interface{}{}); err == nil {
+			t.Error("sum(*)应该返回错误")
+		}
+		if _, err := paymentMapper.GroupBy(nil, []string{"count(*)"}, map[string]interface{}{}); err == nil {
+			t.Error("没有分组的列应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"testing"
+	"vodka"
+	"vodka/analyzer"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type BatchDepMapper struct {
+	mapper.VodkaMapper[Dep, int64]
+	_ struct{} `table:"dep" pk:"id"`
+}
+
+const batchXmlContent = `
+<mapper namespace="BatchMapper">
+	<insert id="InsertTags" batchSize="2">
+		insert into tag (dep_id, name) values
+		<foreach collection="tags" item="tag" separator=",">(#{depId}, #{tag})</foreach>
+	</insert>
+	<insert id="InsertDefaults" batchSize="2">
+		insert into tag (dep_id, name) values
+		<foreach collection="tags" item="tag" separator=",">(0, 'default')</foreach>
+	</insert>
+	<delete id="DeleteNotIn" batchSize="2">
+		delete from dep where id not in
+		<foreach collection="ids" item="id" separator="," open="(" close=")">#{id}</foreach>
+	</delete>
+	<update id="TouchIds" batchSize="2" collection="ids">
+		update dep set descr = 'x' where id in
+		<foreach collection="ids" item="id" separator="," open="(" close=")">#{id}</foreach>
+	</update>
+	<update id="RenameAll" executor="batch">
+		update dep set name = #{name} where id = #{id}
+	</update>
+</mapper>
+`
+
+func newBatchDeps(n int) []*Dep {
+	deps := make([]*Dep, n)
+	for i := range deps {
+		deps[i] = &Dep{Name: "dep", Descr: "descr"}
+	}
+	return deps
+}
+
+func TestBatch(t *testing.T) {
+	defer analyzer.SetBatchOptions(analyzer.GetBatchOptions())
+
+	t.Run("未超过限制时不拆分", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		depMapper := &BatchDepMapper{}
+		if err := vodka.InitMapper(depMapper); err != nil {
+			t.Fatal(err)
+		}
+		rows, _, err := depMapper.InsertBatch(newBatchDeps(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows != 1 || len(fake.Execs()) != 1 || fake.Commits() != 0 {
+			t.Errorf("影响行数: %d, 执行次数: %d, 提交次数: %d", rows, len(fake.Execs()), fake.Commits())
+		}
+	})
+
+	t.Run("默认不限制元素个数", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		if options := analyzer.GetBatchOptions(); options.MaxRows != 0 {
+			t.Errorf("默认不应该限制元素个数: %+v", options)
+		}
+		depMapper := &BatchDepMapper{}
+		if err := vodka.InitMapper(depMapper); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := depMapper.InsertBatch(newBatchDeps(1500)); err != nil {
+			t.Fatal(err)
+		}
+		if len(fake.Execs()) != 1 || fake.Commits() != 0 {
+			t.Errorf("执行次数: %d, 提交次数: %d", len(fake.Execs()), fake.Commits())
+		}
+	})
+
+	t.Run("按占位符个数拆分", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		analyzer.SetBatchOptions(analyzer.BatchOptions{MaxPlaceholders: 6})
+		depMapper := &BatchDepMapper{}
+		if err := vodka.InitMapper(depMapper); err != nil {
+			t.Fatal(err)
+		}
+		// id自增，每行2个占位符，每条语句最多3行
+		rows, lastInsertId, err := depMapper.InsertBatch(newBatchDeps(7))
+		if err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if len(execs) != 3 || rows != 3 || lastInsertId != 1 {
+			t.Fatalf("执行次数: %d, 影响行数: %d, lastInsertId: %d", len(execs), rows, lastInsertId)
+		}
+		for i, expected := range []int{6, 6, 2} {
+			if len(execs[i].Args) != expected {
+				t.Errorf("第%d条语句的参数个数错误: %d", i, len(execs[i].Args))
+			}
+		}
+		if fake.Commits() != 1 {
+			t.Errorf("拆分后的语句应该在同一个事务中执行，提交次数: %d", fake.Commits())
+		}
+	})
+
+	t.Run("语句上的batchSize", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		analyzer.SetBatchOptions(analyzer.BatchOptions{})
+		a := analyzer.NewAnalyzer(batchXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		var rows int64
+		params := map[string]interface{}{"depId": 1, "tags": []string{"a", "b", "c", "d", "e"}}
+		if err := a.Call("InsertTags", params, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if len(execs) != 3 || rows != 3 {
+			t.Fatalf("执行次数: %d, 影响行数: %d", len(execs), rows)
+		}
+		if len(execs[2].Args) != 2 || execs[2].Args[1] != "e" {
+			t.Errorf("最后一批参数错误: %v", execs[2].Args)
+		}
+		if tags := params["tags"].([]string); len(tags) != 5 {
+			t.Errorf("拆分后应该还原参数: %v", tags)
+		}
+	})
+
+	t.Run("没有占位符的语句按元素个数拆分", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		analyzer.SetBatchOptions(analyzer.BatchOptions{MaxPlaceholders: 65535})
+		a := analyzer.NewAnalyzer(batchXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		var rows int64
+		if err := a.Call("InsertDefaults", map[string]interface{}{"tags": []string{"a", "b", "c", "d", "e"}}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if execs := fake.Execs(); len(execs) != 3 || rows != 3 || len(execs[0].Args) != 0 {
+			t.Fatalf("执行次数: %d, 影响行数: %d", len(execs), rows)
+		}
+	})
+
+	t.Run("where中的集合不拆分", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		analyzer.SetBatchOptions(analyzer.BatchOptions{MaxRows: 2})
+		depMapper := &BatchDepMapper{}
+		if err := vodka.InitMapper(depMapper); err != nil {
+			t.Fatal(err)
+		}
+		// not in拆分后每条语句都会删除其他批次的行
+		if _, err := depMapper.DeleteByConditionMap(map[string]interface{}{"NOT_IN_id": []int64{1, 2, 3, 4}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := depMapper.UpdateByConditionMap(map[string]interface{}{"IN_id": []int64{1, 2, 3}, "EQ_name": "a"}, map[string]interface{}{"descr": "x"}); err != nil {
+			t.Fatal(err)
+		}
+		a := analyzer.NewAnalyzer(batchXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		var rows int64
+		if err := a.Call("DeleteNotIn", map[string]interface{}{"ids": []int64{1, 2, 3, 4}}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if len(execs) != 3 {
+			t.Fatalf("执行次数: %d", len(execs))
+		}
+		if query := normalizeSql(execs[0].Query); query != "delete from dep where id not in (?,?,?,?)" || len(execs[0].Args) != 4 {
+			t.Errorf("sql错误: %s %v", query, execs[0].Args)
+		}
+		if len(execs[1].Args) != 5 || len(execs[2].Args) != 4 {
+			t.Errorf("参数错误: %v %v", execs[1].Args, execs[2].Args)
+		}
+	})
+
+	t.Run("collection声明的集合可以拆分", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		analyzer.SetBatchOptions(analyzer.BatchOptions{})
+		a := analyzer.NewAnalyzer(batchXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		var rows int64
+		if err := a.Call("TouchIds", map[string]interface{}{"ids": []int64{1, 2, 3}}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if execs := fake.Execs(); len(execs) != 2 || len(execs[1].Args) != 1 {
+			t.Fatalf("执行次数: %d", len(execs))
+		}
+	})
+
+	t.Run("batch执行器复用预编译语句", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		a := analyzer.NewAnalyzer(batchXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		deps := []*Dep{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}, {Id: 3, Name: "c"}}
+		var rows int64
+		if err := a.Call("RenameAll", map[string]interface{}{"deps": deps}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if len(execs) != 3 || rows != 3 || fake.Prepares() != 1 || fake.Commits() != 1 {
+			t.Fatalf("执行次数: %d, 影响行数: %d, prepare次数: %d, 提交次数: %d", len(execs), rows, fake.Prepares(), fake.Commits())
+		}
+		if execs[1].Args[0] != "b" || execs[1].Args[1] != int64(2) {
+			t.Errorf("参数错误: %v", execs[1].Args)
+		}
+	})
+
+	t.Run("非法的执行器", func(t *testing.T) {
+		a := analyzer.NewAnalyzer(`<mapper namespace="BadBatch"><select id="Bad" executor="batch">select 1</select></mapper>`)
+		if err := a.Parse(); err == nil {
+			t.Error("select使用batch执行器应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Customer struct {
+	Id    int64   `vo:"id"`
+	Name  string  `vo:"name" check:"required,max=5"`
+	Email string  `vo:"email" check:"regexp=^[a-z]+@[a-z]+\\.com$"`
+	Age   *int64  `vo:"age" check:"min=0,max=150"`
+	Tags  string  `vo:"tags" check:"regexp=^[a-z]{1,3}(,[a-z]{1,3})*$"`
+	Score float64 `vo:"score" check:"min=0"`
+}
+
+type CustomerMapper struct {
+	mapper.VodkaMapper[Customer, int64]
+	_ struct{} `table:"customer" pk:"id"`
+}
+
+type BadCheck struct {
+	Id   int64  `vo:"id"`
+	Name string `vo:"name" check:"unknown"`
+}
+
+type BadCheckMapper struct {
+	mapper.VodkaMapper[BadCheck, int64]
+	_ struct{} `table:"bad_check" pk:"id"`
+}
+
+func TestCheck(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	customerMapper := &CustomerMapper{}
+	if err := vodka.InitMapper(customerMapper); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("通过校验", func(t *testing.T) {
+		age := int64(30)
+		if _, _, err := customerMapper.InsertOne(&Customer{Name: "张三", Email: "a@b.com", Age: &age, Tags: "a,bc"}); err != nil {
+			t.Fatal(err)
+		}
+		// 指针为nil时不校验
+		if _, _, err := customerMapper.InsertOne(&Customer{Name: "李四", Email: "a@b.com", Tags: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("列出所有未通过的字段", func(t *testing.T) {
+		execs := len(fake.Execs())
+		age := int64(200)
+		_, _, err := customerMapper.InsertOne(&Customer{Name: "", Email: "A@B.COM", Age: &age, Tags: "abcd", Score: -1})
+		var validationErr *vodka.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("应该返回ValidationError: %v", err)
+		}
+		columns := map[string]string{}
+		for _, field := range validationErr.Fields {
+			columns[field.Column] = field.Rule
+		}
+		expected := map[string]string{"name": "required", "email": "regexp", "age": "max", "tags": "regexp", "score": "min"}
+		if len(columns) != len(expected) {
+			t.Errorf("未通过的字段错误: %v", err)
+		}
+		for column, rule := range expected {
+			if columns[column] != rule {
+				t.Errorf("列 %s 应该未通过 %s: %v", column, rule, err)
+			}
+		}
+		if len(fake.Execs()) != execs {
+			t.Error("校验失败时不应该执行语句")
+		}
+	})
+
+	t.Run("批量插入和更新", func(t *testing.T) {
+		_, _, err := customerMapper.InsertBatch([]*Customer{{Name: "a", Email: "a@b.com", Tags: "a"}, {Name: "abcdef", Email: "a@b.com", Tags: "a"}})
+		var validationErr *vodka.ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Fields) != 1 || validationErr.Fields[0].Index != 1 || validationErr.Fields[0].Rule != "max" {
+			t.Errorf("批量插入的校验错误: %v", err)
+		}
+		if _, err := customerMapper.UpdateById(&Customer{Id: 1, Email: "a@b.com", Tags: "a"}); !errors.As(err, &validationErr) {
+			t.Errorf("UpdateById应该校验: %v", err)
+		}
+		// UpdateSelectiveById不更新零值的字段，也不校验
+		if _, err := customerMapper.UpdateSelectiveById(&Customer{Id: 1, Score: 1}); err != nil {
+			t.Error(err)
+		}
+		if _, err := customerMapper.UpdateSelectiveById(&Customer{Id: 1, Name: "abcdef"}); !errors.As(err, &validationErr) {
+			t.Errorf("UpdateSelectiveById应该校验非零值的字段: %v", err)
+		}
+	})
+
+	t.Run("查询构造器的Update校验被更新的列", func(t *testing.T) {
+		execs := len(fake.Execs())
+		_, err := vodka.Query[Customer]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"name": "", "score": -1})
+		var validationErr *vodka.ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 {
+			t.Fatalf("应该返回ValidationError: %v", err)
+		}
+		if len(fake.Execs()) != execs {
+			t.Error("校验失败时不应该执行语句")
+		}
+		// 没有更新的列不校验
+		if _, err := vodka.Query[Customer]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"email": "a@b.com"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("非法的校验规则", func(t *testing.T) {
+		if err := vodka.InitMapper(&BadCheckMapper{}); err == nil {
+			t.Error("应该返回错误")
+		}
+	})
+}
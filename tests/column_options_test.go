@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Note struct {
+	Id        int64     `vo:"id"`
+	Title     string    `vo:"title"`
+	Body      string    `vo:"body,omitempty"`
+	Score     *int64    `vo:"score,omitempty"`
+	CreatedAt time.Time `vo:"created_at,readonly"`
+	CreatedBy string    `vo:"created_by,insertonly"`
+	Draft     string    `vo:"-"`
+}
+
+type NoteMapper struct {
+	mapper.VodkaMapper[Note, int64]
+	_ struct{} `table:"note" pk:"id"`
+}
+
+type BadColumnOptions struct {
+	Id    int64  `vo:"id"`
+	Title string `vo:"title,readonly,insertonly"`
+}
+
+type BadColumnOptionsMapper struct {
+	mapper.VodkaMapper[BadColumnOptions, int64]
+	_ struct{} `table:"bad" pk:"id"`
+}
+
+func TestColumnOptions(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	noteMapper := &NoteMapper{}
+	if err := vodka.InitMapper(noteMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+	check := func(t *testing.T, call fakeCall, query string, args []driver.Value) {
+		t.Helper()
+		if normalizeSql(call.Query) != query {
+			t.Errorf("sql错误: %s", normalizeSql(call.Query))
+		}
+		if !reflect.DeepEqual(call.Args, args) {
+			t.Errorf("参数错误: %v", call.Args)
+		}
+	}
+
+	t.Run("插入时省略零值和只读的列", func(t *testing.T) {
+		if _, _, err := noteMapper.InsertOne(&Note{Title: "a", CreatedBy: "admin", CreatedAt: time.Now(), Draft: "x"}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, lastExec(), "insert into note (id,title,created_by) values (DEFAULT,?,?)", []driver.Value{"a", "admin"})
+		score := int64(0)
+		if _, _, err := noteMapper.InsertOne(&Note{Title: "a", Body: "b", Score: &score}); err != nil {
+			t.Fatal(err)
+		}
+		// 指针不为nil时即使指向零值也会写入
+		check(t, lastExec(), "insert into note (id,title,body,score,created_by) values (DEFAULT,?,?,?,?)", []driver.Value{"a", "b", int64(0), ""})
+	})
+
+	t.Run("批量插入时零值写入DEFAULT", func(t *testing.T) {
+		if _, _, err := noteMapper.InsertBatch([]*Note{{Title: "a"}, {Title: "b", Body: "c"}}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, lastExec(), "insert into note (id,title,body,score,created_by) values (DEFAULT,?,DEFAULT,DEFAULT,?),(DEFAULT,?,?,DEFAULT,?)",
+			[]driver.Value{"a", "", "b", "c", ""})
+	})
+
+	t.Run("更新时不写入只读和只在插入时写入的列", func(t *testing.T) {
+		if _, err := noteMapper.UpdateById(&Note{Id: 1, Title: "a", CreatedBy: "admin"}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, lastExec(), "update note set title = ?,body = ?,score = ? where id = ?", []driver.Value{"a", "", nil, int64(1)})
+		if _, err := noteMapper.UpdateFieldsById(&Note{Id: 1}, "created_at"); err == nil {
+			t.Error("只读的列不能更新")
+		}
+		if _, err := noteMapper.UpdateFieldsById(&Note{Id: 1}, "created_by"); err == nil {
+			t.Error("只在插入时写入的列不能更新")
+		}
+		if _, err := vodka.Query[Note]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"created_at": time.Now()}); err == nil {
+			t.Error("查询构造器不能更新只读的列")
+		}
+	})
+
+	t.Run("查询时读取只读的列并忽略-", func(t *testing.T) {
+		createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "title", "created_at", "-"}, [][]driver.Value{{int64(1), "a", createdAt, "x"}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		note, err := noteMapper.SelectById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if note.CreatedAt != createdAt || note.Draft != "" {
+			t.Errorf("查询结果错误: %+v", note)
+		}
+	})
+
+	t.Run("readonly和insertonly不能同时声明", func(t *testing.T) {
+		if err := vodka.InitMapper(&BadColumnOptionsMapper{}); err == nil {
+			t.Error("应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type TenantUser struct {
+	TenantId int64  `vo:"tenant_id"`
+	UserId   int64  `vo:"user_id"`
+	Name     string `vo:"name"`
+}
+
+type TenantUserKey struct {
+	TenantId int64 `vo:"tenant_id"`
+	UserId   int64 `vo:"user_id"`
+}
+
+// ID为结构体，按vo标签取每个主键的值
+type TenantUserMapper struct {
+	mapper.VodkaMapper[TenantUser, TenantUserKey]
+	_ struct{} `table:"tenant_user" pk:"tenant_id,user_id"`
+}
+
+// ID为切片，按pk声明的顺序取值
+type TenantUserSliceMapper struct {
+	mapper.VodkaMapper[TenantUser, []any]
+	_ struct{} `table:"tenant_user" pk:"tenant_id,user_id"`
+}
+
+type Article struct {
+	Code  string `vo:"code"`
+	Title string `vo:"title"`
+}
+
+// 非id命名的字符串主键
+type ArticleMapper struct {
+	mapper.VodkaMapper[Article, string]
+	_ struct{} `table:"article" pk:"code"`
+}
+
+type InvalidKeyMapper struct {
+	mapper.VodkaMapper[TenantUser, int64]
+	_ struct{} `table:"tenant_user" pk:"tenant_id,user_id"`
+}
+
+// 联合主键的ID为any时无法确定按结构体还是切片取值
+type AnyKeyMapper struct {
+	mapper.VodkaMapper[TenantUser, any]
+	_ struct{} `table:"tenant_user" pk:"tenant_id,user_id"`
+}
+
+// 没有声明pk时不生成通用方法，sql标签声明的方法仍然可用
+type NoPkMapper struct {
+	mapper.VodkaMapper[TenantUser, int64]
+	_          struct{}              `table:"tenant_user"`
+	CountUsers func() (int64, error) `sql:"select count(*) from tenant_user"`
+}
+
+func TestCompositeKey(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	structMapper := &TenantUserMapper{}
+	sliceMapper := &TenantUserSliceMapper{}
+	articleMapper := &ArticleMapper{}
+	for _, m := range []interface{}{structMapper, sliceMapper, articleMapper} {
+		if err := vodka.InitMapper(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := func(calls []fakeCall) fakeCall {
+		return calls[len(calls)-1]
+	}
+	check := func(t *testing.T, call fakeCall, sql string, args []driver.Value) {
+		t.Helper()
+		if normalizeSql(call.Query) != sql {
+			t.Errorf("sql错误:\n%s\n%s", normalizeSql(call.Query), sql)
+		}
+		if !reflect.DeepEqual(call.Args, args) {
+			t.Errorf("参数错误: %v %v", call.Args, args)
+		}
+	}
+
+	t.Run("结构体ID", func(t *testing.T) {
+		if _, err := structMapper.SelectById(TenantUserKey{TenantId: 1, UserId: 2}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Queries()), "select tenant_id,user_id,name from tenant_user where tenant_id = ? and user_id = ?", []driver.Value{int64(1), int64(2)})
+		if _, err := structMapper.DeleteById(TenantUserKey{TenantId: 3, UserId: 4}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Execs()), "delete from tenant_user where tenant_id = ? and user_id = ?", []driver.Value{int64(3), int64(4)})
+		if _, err := structMapper.SelectByIds([]TenantUserKey{{1, 2}, {1, 3}}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Queries()), "select tenant_id,user_id,name from tenant_user where ((tenant_id = ? and user_id = ?) or (tenant_id = ? and user_id = ?))",
+			[]driver.Value{int64(1), int64(2), int64(1), int64(3)})
+	})
+
+	t.Run("联合主键加锁查询", func(t *testing.T) {
+		defer database.SetDialect(database.GetDialect())
+		database.SetDialect(database.MySQL)
+		err := vodka.Transaction(func() error {
+			if _, err := structMapper.SelectByIdForUpdate(TenantUserKey{TenantId: 1, UserId: 2}); err != nil {
+				return err
+			}
+			check(t, last(fake.Queries()), "select tenant_id,user_id,name from tenant_user where tenant_id = ? and user_id = ? for update", []driver.Value{int64(1), int64(2)})
+			if _, err := sliceMapper.SelectByIdForUpdate([]any{int64(5), int64(6)}, database.ForShare); err != nil {
+				return err
+			}
+			check(t, last(fake.Queries()), "select tenant_id,user_id,name from tenant_user where tenant_id = ? and user_id = ? for share", []driver.Value{int64(5), int64(6)})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("切片ID", func(t *testing.T) {
+		if _, err := sliceMapper.ExistsById([]any{int64(5), int64(6)}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Queries()), "select 1 from tenant_user where tenant_id = ? and user_id = ? limit 1", []driver.Value{int64(5), int64(6)})
+		if _, err := sliceMapper.DeleteByIds([][]any{{int64(1), int64(2)}}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Execs()), "delete from tenant_user where ((tenant_id = ? and user_id = ?))", []driver.Value{int64(1), int64(2)})
+	})
+
+	t.Run("联合主键更新和插入", func(t *testing.T) {
+		if _, err := structMapper.UpdateById(&TenantUser{TenantId: 1, UserId: 2, Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Execs()), "update tenant_user set name = ? where tenant_id = ? and user_id = ?", []driver.Value{"a", int64(1), int64(2)})
+		// 联合主键不使用自增
+		if _, _, err := structMapper.InsertOne(&TenantUser{TenantId: 0, UserId: 2, Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Execs()), "insert into tenant_user (tenant_id,user_id,name) values (?,?,?)", []driver.Value{int64(0), int64(2), "a"})
+	})
+
+	t.Run("字符串主键", func(t *testing.T) {
+		if _, err := articleMapper.SelectById("go-101"); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Queries()), "select code,title from article where code = ?", []driver.Value{"go-101"})
+		// 非整数主键的UpdateById同样带有主键条件
+		if _, err := articleMapper.UpdateById(&Article{Code: "go-101", Title: "t"}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, last(fake.Execs()), "update article set title = ? where code = ?", []driver.Value{"t", "go-101"})
+	})
+
+	t.Run("联合主键的ID类型不能是基本类型", func(t *testing.T) {
+		if err := vodka.InitMapper(&InvalidKeyMapper{}); err == nil {
+			t.Error("应该返回错误")
+		}
+		if err := vodka.InitMapper(&AnyKeyMapper{}); err == nil {
+			t.Error("联合主键的ID为any时应该返回错误")
+		}
+	})
+
+	t.Run("没有声明pk时不生成通用方法", func(t *testing.T) {
+		noPkMapper := &NoPkMapper{}
+		if err := vodka.InitMapper(noPkMapper); err != nil {
+			t.Fatal(err)
+		}
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"count(*)"}, [][]driver.Value{{int64(3)}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		if count, err := noPkMapper.CountUsers(); err != nil || count != 3 {
+			t.Errorf("sql标签声明的方法应该可用: %d %v", count, err)
+		}
+		if _, err := noPkMapper.SelectById(1); err == nil {
+			t.Error("没有生成的通用方法应该返回错误")
+		}
+	})
+}
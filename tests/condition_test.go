@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type ConditionDepMapper struct {
+	mapper.VodkaMapper[Dep, int64]
+	_ struct{} `table:"dep" pk:"id"`
+}
+
+func newConditionDepMapper(t *testing.T) (*ConditionDepMapper, *fakeDatabase) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	depMapper := &ConditionDepMapper{}
+	if err := vodka.InitMapper(depMapper); err != nil {
+		t.Fatal(err)
+	}
+	return depMapper, fake
+}
+
+func TestConditionApis(t *testing.T) {
+	t.Run("SelectByIds", func(t *testing.T) {
+		depMapper, fake := newConditionDepMapper(t)
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name"}, [][]driver.Value{{int64(1), "a"}, {int64(3), "c"}}, nil
+		}
+		deps, err := depMapper.SelectByIds([]int64{1, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deps) != 2 || deps[1].Name != "c" {
+			t.Errorf("结果错误: %v", deps)
+		}
+		query := fake.Queries()[0]
+		if normalizeSql(query.Query) != "select id,name,descr from dep where id in (?,?,?)" || len(query.Args) != 3 {
+			t.Errorf("sql错误: %s %v", query.Query, query.Args)
+		}
+	})
+
+	t.Run("DeleteByIds为空时不删除任何行", func(t *testing.T) {
+		depMapper, fake := newConditionDepMapper(t)
+		if _, err := depMapper.DeleteByIds(nil); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(fake.Execs()[0].Query); query != "delete from dep where 1 = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("按条件删除必须有条件", func(t *testing.T) {
+		depMapper, fake := newConditionDepMapper(t)
+		if _, err := depMapper.DeleteByCondition(&Dep{}); err == nil {
+			t.Error("没有条件时应该返回错误")
+		}
+		if _, err := depMapper.DeleteByConditionMap(map[string]interface{}{}); err == nil {
+			t.Error("没有条件时应该返回错误")
+		}
+		if _, err := depMapper.DeleteByConditionMap(map[string]interface{}{"EQ_name": "dep1"}); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if len(execs) != 1 || normalizeSql(execs[0].Query) != "delete from dep where name = ?" {
+			t.Errorf("sql错误: %v", execs)
+		}
+	})
+
+	t.Run("ExistsById", func(t *testing.T) {
+		depMapper, fake := newConditionDepMapper(t)
+		exists, err := depMapper.ExistsById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("没有数据时应该返回false")
+		}
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"1"}, [][]driver.Value{{int64(1)}}, nil
+		}
+		if exists, _ = depMapper.ExistsById(1); !exists {
+			t.Error("有数据时应该返回true")
+		}
+		if query := normalizeSql(fake.Queries()[0].Query); query != "select 1 from dep where id = ? limit 1" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("SelectOne", func(t *testing.T) {
+		depMapper, fake := newConditionDepMapper(t)
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name"}, [][]driver.Value{{int64(2), "b"}}, nil
+		}
+		dep, err := depMapper.SelectOne(&Dep{Name: "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dep == nil || dep.Id != 2 {
+			t.Errorf("结果错误: %v", dep)
+		}
+		if _, err := depMapper.SelectOneByMap(map[string]interface{}{"GT_id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		queries := fake.Queries()
+		if normalizeSql(queries[0].Query) != "select id,name,descr from dep where name = ? limit 1" {
+			t.Errorf("sql错误: %s", queries[0].Query)
+		}
+		if normalizeSql(queries[1].Query) != "select id,name,descr from dep where id > ? limit 1" {
+			t.Errorf("sql错误: %s", queries[1].Query)
+		}
+	})
+}
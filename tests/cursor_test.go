@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"testing"
+	"time"
+	"vodka/plugin/page"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("游标编解码", func(t *testing.T) {
+		createdAt := time.Date(2024, 10, 1, 12, 30, 0, 0, time.UTC)
+		token, err := page.EncodeCursor([]interface{}{createdAt, int64(1024), "张三"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := page.DecodeCursor(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 3 {
+			t.Fatalf("解码个数错误: %v", values)
+		}
+		if !values[0].(time.Time).Equal(createdAt) {
+			t.Errorf("时间解码错误: %v", values[0])
+		}
+		if values[1] != int64(1024) {
+			t.Errorf("整数解码错误: %v", values[1])
+		}
+		if values[2] != "张三" {
+			t.Errorf("字符串解码错误: %v", values[2])
+		}
+	})
+
+	t.Run("非法游标", func(t *testing.T) {
+		if _, err := page.DecodeCursor("not a cursor"); err == nil {
+			t.Error("非法游标应该返回错误")
+		}
+	})
+
+	t.Run("测试游标分页查询", func(t *testing.T) {
+		Prepare(t)
+
+		var cursor page.Cursor[User]
+		cursor.Keys = []string{"id"}
+		cursor.Desc = true
+		cursor.Size = 2
+		err := page.DoCursor(&cursor, func() {
+			userMapper.GetUsers()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cursor.HasMore {
+			next := page.Cursor[User]{Keys: cursor.Keys, Desc: true, Size: 2, After: cursor.Next}
+			err = page.DoCursor(&next, func() {
+				userMapper.GetUsers()
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(next.List) > 0 && next.List[0].Id >= cursor.List[len(cursor.List)-1].Id {
+				t.Errorf("第二页应该接在第一页之后")
+			}
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"vodka"
+	"vodka/database"
+	"vodka/encrypt"
+	mapper "vodka/mapper"
+)
+
+type Patient struct {
+	Id    int64   `vo:"id"`
+	Name  string  `vo:"name"`
+	Phone string  `vo:"phone,encrypt=deterministic"`
+	Note  *string `vo:"note,encrypt"`
+}
+
+type PatientMapper struct {
+	mapper.VodkaMapper[Patient, int64]
+	_ struct{} `table:"patient" pk:"id"`
+}
+
+type BadEncrypt struct {
+	Id  int64 `vo:"id"`
+	Age int64 `vo:"age,encrypt"`
+}
+
+type BadEncryptMapper struct {
+	mapper.VodkaMapper[BadEncrypt, int64]
+	_ struct{} `table:"bad_encrypt" pk:"id"`
+}
+
+func TestEncrypt(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	keys := &encrypt.StaticKeys{Current: "k1", Keys: map[string][]byte{
+		"k1": []byte("0123456789abcdef0123456789abcdef"),
+		"k2": []byte("fedcba9876543210fedcba9876543210"),
+	}}
+	vodka.RegisterKeyProvider(keys)
+	defer vodka.RegisterKeyProvider(nil)
+	patientMapper := &PatientMapper{}
+	if err := vodka.InitMapper(patientMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+	lastQuery := func() fakeCall {
+		queries := fake.Queries()
+		return queries[len(queries)-1]
+	}
+	decrypt := func(t *testing.T, value driver.Value) string {
+		t.Helper()
+		plaintext, err := encrypt.Decrypt(value.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plaintext
+	}
+	phone, err := encrypt.Encrypt("13800000000", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("写入时加密", func(t *testing.T) {
+		note := "过敏"
+		if _, _, err := patientMapper.InsertOne(&Patient{Name: "张三", Phone: "13800000000", Note: &note}); err != nil {
+			t.Fatal(err)
+		}
+		first := lastExec().Args
+		if first[0] != "张三" || first[1] != phone || decrypt(t, first[2]) != note {
+			t.Errorf("参数错误: %v", first)
+		}
+		// 随机加密每次的密文都不同
+		if _, _, err := patientMapper.InsertBatch([]*Patient{{Name: "张三", Phone: "13800000000", Note: &note}}); err != nil {
+			t.Fatal(err)
+		}
+		second := lastExec().Args
+		if second[1] != phone || second[2] == first[2] || decrypt(t, second[2]) != note {
+			t.Errorf("参数错误: %v", second)
+		}
+		// nil仍然写入NULL
+		if _, err := patientMapper.UpdateById(&Patient{Id: 1, Name: "李四", Phone: "13800000000"}); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastExec().Args; args[1] != phone || args[2] != nil {
+			t.Errorf("参数错误: %v", args)
+		}
+		if _, err := vodka.Query[Patient]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"phone": "13800000000"}); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastExec().Args; args[0] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("确定性加密的列可以等值查询", func(t *testing.T) {
+		if _, err := patientMapper.SelectAllByMap(map[string]interface{}{"EQ_phone": "13800000000"}, "", 0, 10); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastQuery().Args; args[0] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+		if _, err := patientMapper.SelectOne(&Patient{Phone: "13800000000"}); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastQuery().Args; args[0] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+		if _, err := vodka.Query[Patient]().Where(vodka.Or(vodka.Eq("phone", "13800000000"), vodka.In("phone", []string{"13800000000"}))).Select(); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastQuery().Args; len(args) != 2 || args[0] != phone || args[1] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("确定性加密的列可以in查询", func(t *testing.T) {
+		if _, err := patientMapper.SelectAllByMap(map[string]interface{}{"IN_phone": []string{"13800000000", "13800000000"}}, "", 0, 10); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastQuery().Args; len(args) != 4 || args[0] != phone || args[1] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+		if _, err := patientMapper.DeleteByConditionMap(map[string]interface{}{"NOT_IN_phone": []string{"13800000000"}}); err != nil {
+			t.Fatal(err)
+		}
+		if args := lastExec().Args; len(args) != 1 || args[0] != phone {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("随机加密的列不能作为条件", func(t *testing.T) {
+		queries := len(fake.Queries())
+		if _, err := patientMapper.SelectAllByMap(map[string]interface{}{"EQ_note": "过敏"}, "", 0, 10); err == nil {
+			t.Error("map条件应该返回错误")
+		}
+		if _, err := patientMapper.SelectAllByMap(map[string]interface{}{"OR": []map[string]interface{}{{"LIKE_note": "过"}}}, "", 0, 10); err == nil {
+			t.Error("OR分组应该返回错误")
+		}
+		note := "过敏"
+		if _, err := patientMapper.SelectAll(&Patient{Note: &note}, "", 0, 10); err == nil {
+			t.Error("实体条件应该返回错误")
+		}
+		if _, err := vodka.Query[Patient]().Where(vodka.Eq("note", "过敏")).Select(); err == nil {
+			t.Error("查询构造器应该返回错误")
+		}
+		if len(fake.Queries()) != queries {
+			t.Errorf("不应该执行查询: %v", fake.Queries()[queries:])
+		}
+		// 判断是否为空不需要加密
+		if _, err := patientMapper.SelectAllByMap(map[string]interface{}{"IS_NULL_note": true}, "", 0, 10); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("查询时解密", func(t *testing.T) {
+		note, _ := encrypt.Encrypt("过敏", false)
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name", "phone", "note"}, [][]driver.Value{{int64(1), "张三", phone, note}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		patient, err := patientMapper.SelectById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if patient.Phone != "13800000000" || patient.Note == nil || *patient.Note != "过敏" {
+			t.Errorf("解密错误: %+v", patient)
+		}
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "phone"}, [][]driver.Value{{int64(1), "13800000000"}}, nil
+		}
+		if _, err := patientMapper.SelectById(1); err == nil {
+			t.Error("没有密钥前缀的数据解密应该返回错误")
+		}
+	})
+
+	t.Run("密钥轮换", func(t *testing.T) {
+		keys.Current = "k2"
+		defer func() { keys.Current = "k1" }()
+		rotated, err := encrypt.Encrypt("13800000000", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(rotated, "k2:") || rotated == phone {
+			t.Errorf("应该使用新的密钥: %s", rotated)
+		}
+		// 旧密钥加密的数据仍然可以解密
+		if plaintext, err := encrypt.Decrypt(phone); err != nil || plaintext != "13800000000" {
+			t.Errorf("解密错误: %s %v", plaintext, err)
+		}
+	})
+
+	t.Run("只有字符串的列可以加密", func(t *testing.T) {
+		if err := vodka.InitMapper(&BadEncryptMapper{}); err == nil {
+			t.Error("应该返回错误")
+		}
+	})
+}
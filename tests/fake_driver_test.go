@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 用于不依赖MySQL的测试，记录所有执行过的语句
+
+type fakeCall struct {
+	Query string
+	Args  []driver.Value
+}
+
+type fakeDatabase struct {
+	mu        sync.Mutex
+	prepares  int
+	execs     []fakeCall
+	queries   []fakeCall
+	commits   int
+	rollbacks int
+	nextId    int64
+
+	// 自定义返回值，为空时insert/update/delete影响一行，查询返回空
+	onExec  func(query string, args []driver.Value) (driver.Result, error)
+	onQuery func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+}
+
+var fakeDatabases sync.Map
+var fakeSeq int64
+
+func init() {
+	sql.Register("vodka_fake", fakeDriver{})
+}
+
+// 打开一个新的假数据库
+func openFakeDB(t testing.TB) (*sql.DB, *fakeDatabase) {
+	name := fmt.Sprintf("fake_%d", atomic.AddInt64(&fakeSeq, 1))
+	fake := &fakeDatabase{}
+	fakeDatabases.Store(name, fake)
+	db, err := sql.Open("vodka_fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+func (f *fakeDatabase) Prepares() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.prepares
+}
+
+func (f *fakeDatabase) Commits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commits
+}
+
+func (f *fakeDatabase) Rollbacks() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rollbacks
+}
+
+func (f *fakeDatabase) Execs() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeCall(nil), f.execs...)
+}
+
+func (f *fakeDatabase) Queries() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeCall(nil), f.queries...)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fake, ok := fakeDatabases.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown fake database %s", name)
+	}
+	return &fakeConn{db: fake.(*fakeDatabase)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	c.db.prepares++
+	c.db.mu.Unlock()
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{db: c.db}, nil }
+
+type fakeTx struct {
+	db *fakeDatabase
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.rollbacks++
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDatabase
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	s.db.execs = append(s.db.execs, fakeCall{Query: s.query, Args: args})
+	onExec := s.db.onExec
+	s.db.nextId++
+	id := s.db.nextId
+	s.db.mu.Unlock()
+	if onExec != nil {
+		return onExec(s.query, args)
+	}
+	return fakeResult{lastInsertId: id, rowsAffected: 1}, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	s.db.queries = append(s.db.queries, fakeCall{Query: s.query, Args: args})
+	onQuery := s.db.onQuery
+	s.db.mu.Unlock()
+	if onQuery == nil {
+		return &fakeRows{}, nil
+	}
+	columns, values, err := onQuery(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, values: values}, nil
+}
+
+type fakeResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertId, nil }
+
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
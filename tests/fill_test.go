@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Document struct {
+	Id        int64     `vo:"id"`
+	Title     string    `vo:"title"`
+	CreatedAt time.Time `vo:"created_at,fill=insert"`
+	UpdatedAt time.Time `vo:"updated_at,fill=insert_update"`
+	CreatedBy string    `vo:"created_by,fill=insert"`
+	UpdatedBy string    `vo:"updated_by,fill=insert_update"`
+}
+
+type DocumentMapper struct {
+	mapper.VodkaMapper[Document, int64]
+	_ struct{} `table:"document" pk:"id"`
+}
+
+type userKey struct{}
+
+func TestAutoFill(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	documentMapper := &DocumentMapper{}
+	if err := vodka.InitMapper(documentMapper); err != nil {
+		t.Fatal(err)
+	}
+	vodka.RegisterFillHandler(func(ctx context.Context, entity interface{}, op mapper.FillOperation) map[string]interface{} {
+		user, _ := ctx.Value(userKey{}).(string)
+		if op == mapper.FillInsert {
+			return map[string]interface{}{"created_by": user, "updated_by": user}
+		}
+		return map[string]interface{}{"updated_by": user}
+	})
+	defer vodka.RegisterFillHandler(nil)
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+	ctx := context.WithValue(context.Background(), userKey{}, "admin")
+
+	t.Run("插入时填充", func(t *testing.T) {
+		document := &Document{Title: "a"}
+		vodka.WithContext(ctx, func() {
+			if _, _, err := documentMapper.InsertOne(document); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if document.CreatedAt.IsZero() || document.UpdatedAt.IsZero() || document.CreatedBy != "admin" || document.UpdatedBy != "admin" {
+			t.Errorf("填充错误: %+v", document)
+		}
+		args := lastExec().Args
+		if args[2] != document.CreatedAt || args[4] != "admin" {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("插入时不覆盖已有的值", func(t *testing.T) {
+		createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		documents := []*Document{{Title: "a", CreatedAt: createdAt, CreatedBy: "system"}, {Title: "b"}}
+		if _, _, err := documentMapper.InsertBatch(documents); err != nil {
+			t.Fatal(err)
+		}
+		if documents[0].CreatedAt != createdAt || documents[0].CreatedBy != "system" {
+			t.Errorf("不应该覆盖已有的值: %+v", documents[0])
+		}
+		if documents[1].CreatedAt.IsZero() || documents[1].CreatedBy != "" {
+			t.Errorf("填充错误: %+v", documents[1])
+		}
+	})
+
+	t.Run("更新时填充", func(t *testing.T) {
+		document := &Document{Id: 1, Title: "b", UpdatedBy: "old"}
+		vodka.WithContext(ctx, func() {
+			if _, err := documentMapper.UpdateById(document); err != nil {
+				t.Fatal(err)
+			}
+		})
+		exec := lastExec()
+		// 只在插入时填充的列不会被更新
+		if query := normalizeSql(exec.Query); query != "update document set title = ?,updated_at = ?,updated_by = ? where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if document.UpdatedBy != "admin" || exec.Args[2] != "admin" {
+			t.Errorf("填充错误: %+v %v", document, exec.Args)
+		}
+		if !document.CreatedAt.IsZero() {
+			t.Error("更新时不应该填充created_at")
+		}
+	})
+
+	t.Run("UpdateFieldsById追加填充的列", func(t *testing.T) {
+		if _, err := documentMapper.UpdateFieldsById(&Document{Id: 1, Title: "c"}, "title"); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update document set title = ?,updated_at = ?,updated_by = ? where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := documentMapper.UpdateFieldsById(&Document{Id: 1}); err == nil {
+			t.Error("没有指定列时应该返回错误")
+		}
+		if _, err := documentMapper.UpdateFieldsById(&Document{Id: 1}, "created_at"); err == nil {
+			t.Error("只在插入时填充的列不能更新")
+		}
+	})
+
+	t.Run("查询构造器的Update填充", func(t *testing.T) {
+		values := map[string]interface{}{"title": "d"}
+		vodka.WithContext(ctx, func() {
+			if _, err := vodka.Query[Document]().Where(vodka.Eq("id", 1)).Update(values); err != nil {
+				t.Fatal(err)
+			}
+		})
+		exec := lastExec()
+		if query := normalizeSql(exec.Query); query != "update document set title = ?,updated_at = ?,updated_by = ? where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if updatedAt, ok := exec.Args[1].(time.Time); !ok || updatedAt.IsZero() || exec.Args[2] != "admin" {
+			t.Errorf("填充错误: %v", exec.Args)
+		}
+		if len(values) != 1 {
+			t.Errorf("不应该修改传入的map: %v", values)
+		}
+	})
+
+	t.Run("WithContext可以嵌套", func(t *testing.T) {
+		vodka.WithContext(ctx, func() {
+			vodka.WithContext(context.WithValue(ctx, userKey{}, "inner"), func() {
+				if user := mapper.CurrentContext().Value(userKey{}); user != "inner" {
+					t.Errorf("上下文错误: %v", user)
+				}
+			})
+			if user := mapper.CurrentContext().Value(userKey{}); user != "admin" {
+				t.Errorf("应该恢复外层的上下文: %v", user)
+			}
+		})
+		if mapper.CurrentContext() != context.Background() {
+			t.Error("结束后应该恢复为context.Background()")
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"vodka"
+	"vodka/analyzer"
+	"vodka/database"
+)
+
+const generatedKeysXmlContent = `
+<mapper namespace="GeneratedKeysMapper">
+	<insert id="InsertDep" keyProperty="dep.id">
+		insert into dep (name) values (#{dep.name})
+	</insert>
+	<insert id="InsertName" keyProperty="id">
+		insert into dep (name) values (#{name})
+	</insert>
+	<insert id="InsertDeps" keyProperty="id">
+		insert into dep (name) values
+		<foreach collection="deps" item="dep" separator=",">(#{dep.name})</foreach>
+	</insert>
+</mapper>
+`
+
+func TestGeneratedKeys(t *testing.T) {
+	defer database.SetDialect(database.GetDialect())
+	defer analyzer.SetBatchOptions(analyzer.GetBatchOptions())
+	database.SetDialect(database.MySQL)
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	// 每条语句的第一个id为 100 * 第几条语句
+	execCount := int64(0)
+	fake.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		execCount++
+		return fakeResult{lastInsertId: execCount * 100, rowsAffected: int64(len(args))}, nil
+	}
+	defer func() { fake.onExec = nil }()
+	depMapper := &BatchDepMapper{}
+	if err := vodka.InitMapper(depMapper); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("InsertOne写回自增主键", func(t *testing.T) {
+		execCount = 0
+		dep := &Dep{Name: "a", Descr: "b"}
+		if _, lastInsertId, err := depMapper.InsertOne(dep); err != nil || lastInsertId != 100 {
+			t.Fatal(lastInsertId, err)
+		}
+		if dep.Id != 100 {
+			t.Errorf("主键应该写回实体: %d", dep.Id)
+		}
+	})
+
+	t.Run("InsertBatch按连续的id写回", func(t *testing.T) {
+		execCount = 0
+		deps := []*Dep{{Name: "a"}, {Id: 7, Name: "b"}, {Name: "c"}}
+		if _, _, err := depMapper.InsertBatch(deps); err != nil {
+			t.Fatal(err)
+		}
+		// 已经有主键的元素不占用生成的id
+		if deps[0].Id != 100 || deps[1].Id != 7 || deps[2].Id != 101 {
+			t.Errorf("主键错误: %d %d %d", deps[0].Id, deps[1].Id, deps[2].Id)
+		}
+	})
+
+	t.Run("按auto_increment_increment的步长写回", func(t *testing.T) {
+		execCount = 0
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"step"}, [][]driver.Value{{[]byte("2")}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		deps := []*Dep{{Name: "a"}, {Id: 7, Name: "b"}, {Name: "c"}, {Name: "d"}}
+		if _, _, err := depMapper.InsertBatch(deps); err != nil {
+			t.Fatal(err)
+		}
+		if deps[0].Id != 100 || deps[1].Id != 7 || deps[2].Id != 102 || deps[3].Id != 104 {
+			t.Errorf("主键错误: %d %d %d %d", deps[0].Id, deps[1].Id, deps[2].Id, deps[3].Id)
+		}
+		queries := fake.Queries()
+		if query := normalizeSql(queries[len(queries)-1].Query); query != "select @@auto_increment_increment as step" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("拆分执行时每条语句分别写回", func(t *testing.T) {
+		execCount = 0
+		analyzer.SetBatchOptions(analyzer.BatchOptions{MaxRows: 2})
+		defer analyzer.SetBatchOptions(analyzer.BatchOptions{})
+		deps := newBatchDeps(5)
+		if _, _, err := depMapper.InsertBatch(deps); err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range []int64{100, 101, 200, 201, 300} {
+			if deps[i].Id != expected {
+				t.Errorf("第%d个元素的主键错误: %d", i, deps[i].Id)
+			}
+		}
+	})
+
+	a := analyzer.NewAnalyzer(generatedKeysXmlContent)
+	if err := a.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("xml中使用keyProperty", func(t *testing.T) {
+		execCount = 0
+		dep := &Dep{Name: "a"}
+		var rows int64
+		if err := a.Call("InsertDep", map[string]interface{}{"dep": dep, "other": 1}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if dep.Id != 100 {
+			t.Errorf("主键应该写回实体: %d", dep.Id)
+		}
+	})
+
+	t.Run("没有路径时只写回被展开的参数", func(t *testing.T) {
+		execCount = 0
+		dep := &Dep{Name: "a"}
+		var rows int64
+		if err := a.Call("InsertName", map[string]interface{}{"dep": dep}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if dep.Id != 100 {
+			t.Errorf("主键应该写回实体: %d", dep.Id)
+		}
+		// 多个参数时都没有被展开，不会写回其中任何一个
+		first, second := &Dep{Name: "a"}, &Dep{Name: "b"}
+		if err := a.Call("InsertName", map[string]interface{}{"first": first, "second": second, "name": "c"}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if first.Id != 0 || second.Id != 0 {
+			t.Errorf("主键不应该写回没有展开的参数: %d %d", first.Id, second.Id)
+		}
+	})
+
+	t.Run("returning", func(t *testing.T) {
+		database.SetDialect(database.PostgreSQL)
+		defer database.SetDialect(database.MySQL)
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			values := make([][]driver.Value, len(args))
+			for i := range args {
+				values[i] = []driver.Value{int64(i + 11)}
+			}
+			return []string{"id"}, values, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		deps := newBatchDeps(3)
+		deps[1].Id = 5
+		var rows, lastInsertId int64
+		if err := a.Call("InsertDeps", map[string]interface{}{"deps": deps}, []interface{}{&rows, &lastInsertId}); err != nil {
+			t.Fatal(err)
+		}
+		queries := fake.Queries()
+		if query := normalizeSql(queries[len(queries)-1].Query); !strings.HasSuffix(query, "returning id") {
+			t.Errorf("sql错误: %s", query)
+		}
+		// returning按顺序返回每一行的主键
+		if rows != 3 || lastInsertId != 11 || deps[0].Id != 11 || deps[1].Id != 12 || deps[2].Id != 13 {
+			t.Errorf("结果错误: %d %d %d %d %d", rows, lastInsertId, deps[0].Id, deps[1].Id, deps[2].Id)
+		}
+	})
+
+	t.Run("只有insert可以使用keyProperty", func(t *testing.T) {
+		bad := analyzer.NewAnalyzer(`<mapper namespace="BadKeyProperty"><update id="Bad" keyProperty="id">update dep set name = 'a'</update></mapper>`)
+		if err := bad.Parse(); err == nil {
+			t.Error("update使用keyProperty时应该返回错误")
+		}
+	})
+}
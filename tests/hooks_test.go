@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type hookUserKey struct{}
+
+// 记录回调的调用顺序
+var hookEvents []string
+
+type MemberCard struct {
+	Id        int64  `vo:"id"`
+	Name      string `vo:"name"`
+	Email     string `vo:"email"`
+	CreatedBy string `vo:"created_by"`
+	Display   string `vo:"-"`
+}
+
+func (a *MemberCard) BeforeInsert(ctx context.Context) error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Email = strings.ToLower(a.Email)
+	if a.Name == "" {
+		return errors.New("name不能为空")
+	}
+	if user, ok := ctx.Value(hookUserKey{}).(string); ok {
+		a.CreatedBy = user
+	}
+	hookEvents = append(hookEvents, "BeforeInsert")
+	return nil
+}
+
+func (a *MemberCard) AfterInsert(ctx context.Context) error {
+	hookEvents = append(hookEvents, "AfterInsert")
+	return nil
+}
+
+func (a *MemberCard) AfterUpdate(ctx context.Context) error {
+	if a.Name == "rollback" {
+		return errors.New("更新后校验失败")
+	}
+	hookEvents = append(hookEvents, "AfterUpdate")
+	return nil
+}
+
+func (a *MemberCard) BeforeDelete(ctx context.Context) error {
+	if a.Id == 1 {
+		return errors.New("不能删除管理员")
+	}
+	return nil
+}
+
+func (a *MemberCard) AfterFind(ctx context.Context) error {
+	a.Display = a.Name + " <" + a.Email + ">"
+	return nil
+}
+
+type MemberCardMapper struct {
+	mapper.VodkaMapper[MemberCard, int64]
+	_ struct{} `table:"member_card" pk:"id"`
+}
+
+func TestHooks(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	memberCardMapper := &MemberCardMapper{}
+	if err := vodka.InitMapper(memberCardMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+
+	t.Run("插入前规范化数据", func(t *testing.T) {
+		hookEvents = nil
+		ctx := context.WithValue(context.Background(), hookUserKey{}, "admin")
+		vodka.WithContext(ctx, func() {
+			if _, _, err := memberCardMapper.InsertOne(&MemberCard{Name: " 张三 ", Email: "A@B.COM"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if args := lastExec().Args; !reflect.DeepEqual(args, []driver.Value{"张三", "a@b.com", "admin"}) {
+			t.Errorf("参数错误: %v", args)
+		}
+		if !reflect.DeepEqual(hookEvents, []string{"BeforeInsert", "AfterInsert"}) {
+			t.Errorf("回调顺序错误: %v", hookEvents)
+		}
+		// 批量插入对每个元素调用
+		hookEvents = nil
+		if _, _, err := memberCardMapper.InsertBatch([]*MemberCard{{Name: "a"}, {Name: "b"}}); err != nil {
+			t.Fatal(err)
+		}
+		if len(hookEvents) != 4 {
+			t.Errorf("回调次数错误: %v", hookEvents)
+		}
+	})
+
+	t.Run("回调返回错误时中止", func(t *testing.T) {
+		execs := len(fake.Execs())
+		if _, _, err := memberCardMapper.InsertOne(&MemberCard{Name: " "}); err == nil {
+			t.Error("应该返回错误")
+		}
+		if _, err := memberCardMapper.DeleteByCondition(&MemberCard{Id: 1}); err == nil {
+			t.Error("应该返回错误")
+		}
+		if len(fake.Execs()) != execs {
+			t.Error("回调返回错误时不应该执行语句")
+		}
+		// 按主键、map条件删除时没有实体，不调用删除的回调
+		if _, err := memberCardMapper.DeleteById(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := memberCardMapper.DeleteByIds([]int64{1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := memberCardMapper.DeleteByConditionMap(map[string]interface{}{"EQ_id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if len(fake.Execs()) != execs+3 {
+			t.Error("没有实体的删除应该直接执行")
+		}
+		// 查询构造器没有实体可以调用回调，实现了回调的实体不能使用Update、Delete
+		if _, err := vodka.Query[MemberCard]().Where(vodka.Eq("id", 1)).Delete(); err == nil {
+			t.Error("实现了删除的回调时应该返回错误")
+		}
+		if _, err := vodka.Query[MemberCard]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"name": "a"}); err == nil {
+			t.Error("实现了更新的回调时应该返回错误")
+		}
+		if len(fake.Execs()) != execs+3 {
+			t.Error("返回错误时不应该执行语句")
+		}
+		// 写入后的回调返回错误时回滚
+		rollbacks := fake.Rollbacks()
+		if _, err := memberCardMapper.UpdateById(&MemberCard{Id: 2, Name: "rollback"}); err == nil {
+			t.Error("应该返回错误")
+		}
+		if fake.Rollbacks() != rollbacks+1 {
+			t.Error("应该回滚")
+		}
+	})
+
+	t.Run("查询后计算派生字段", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name", "email"}, [][]driver.Value{{int64(2), "张三", "a@b.com"}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		card, err := memberCardMapper.SelectById(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if card.Display != "张三 <a@b.com>" {
+			t.Errorf("派生字段错误: %+v", card)
+		}
+		cards, err := vodka.Query[MemberCard]().Where(vodka.Eq("id", 2)).Select()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cards) != 1 || cards[0].Display != "张三 <a@b.com>" {
+			t.Errorf("派生字段错误: %+v", cards)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"vodka"
+	"vodka/analyzer"
+	"vodka/database"
+	"vodka/keygen"
+	mapper "vodka/mapper"
+)
+
+type Order struct {
+	Id    int64  `vo:"id"`
+	Title string `vo:"title"`
+}
+
+type OrderMapper struct {
+	mapper.VodkaMapper[Order, int64]
+	_ struct{} `table:"orders" pk:"id" keygen:"snowflake"`
+}
+
+type Device struct {
+	Id   string `vo:"id"`
+	Name string `vo:"name"`
+}
+
+type UUIDDeviceMapper struct {
+	mapper.VodkaMapper[Device, string]
+	_ struct{} `table:"device" pk:"id" keygen:"uuid"`
+}
+
+type CustomDeviceMapper struct {
+	mapper.VodkaMapper[Device, string]
+	_ struct{} `table:"device" pk:"id" keygen:"device_seq"`
+}
+
+type UnknownKeyGenMapper struct {
+	mapper.VodkaMapper[Device, string]
+	_ struct{} `table:"device" pk:"id" keygen:"unknown"`
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestKeyGenerator(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+
+	t.Run("内置生成器", func(t *testing.T) {
+		ids := make(map[int64]bool)
+		for i := 0; i < 10000; i++ {
+			id, err := keygen.NextSnowflake()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids[id] {
+				t.Fatalf("snowflake重复: %d", id)
+			}
+			ids[id] = true
+		}
+		id, _ := keygen.NewUUID()
+		if !uuidRegexp.MatchString(id) {
+			t.Errorf("uuid格式错误: %s", id)
+		}
+		first, _ := keygen.NewULID()
+		second, _ := keygen.NewULID()
+		if len(first) != 26 || first[:10] > second[:10] {
+			t.Errorf("ulid格式错误: %s %s", first, second)
+		}
+		if err := keygen.SetSnowflakeNode(1024); err == nil {
+			t.Error("节点号超出范围时应该返回错误")
+		}
+	})
+
+	t.Run("snowflake主键", func(t *testing.T) {
+		orderMapper := &OrderMapper{}
+		if err := vodka.InitMapper(orderMapper); err != nil {
+			t.Fatal(err)
+		}
+		order := &Order{Title: "a"}
+		if _, _, err := orderMapper.InsertOne(order); err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if order.Id == 0 || exec.Args[0] != order.Id {
+			t.Errorf("主键错误: %d %v", order.Id, exec.Args)
+		}
+		// 已经有值的主键不会被覆盖
+		orders := []*Order{{Id: 7, Title: "a"}, {Title: "b"}}
+		if _, _, err := orderMapper.InsertBatch(orders); err != nil {
+			t.Fatal(err)
+		}
+		if orders[0].Id != 7 || orders[1].Id == 0 || lastExec().Args[2] != orders[1].Id {
+			t.Errorf("批量插入的主键错误: %d %d %v", orders[0].Id, orders[1].Id, lastExec().Args)
+		}
+	})
+
+	t.Run("uuid主键", func(t *testing.T) {
+		deviceMapper := &UUIDDeviceMapper{}
+		if err := vodka.InitMapper(deviceMapper); err != nil {
+			t.Fatal(err)
+		}
+		device := &Device{Name: "a"}
+		if _, _, err := deviceMapper.InsertOne(device); err != nil {
+			t.Fatal(err)
+		}
+		if !uuidRegexp.MatchString(device.Id) || lastExec().Args[0] != device.Id {
+			t.Errorf("主键错误: %s %v", device.Id, lastExec().Args)
+		}
+	})
+
+	t.Run("自定义生成器", func(t *testing.T) {
+		seq := 0
+		keygen.Register("device_seq", func() (interface{}, error) {
+			seq++
+			return seq, nil
+		})
+		deviceMapper := &CustomDeviceMapper{}
+		if err := vodka.InitMapper(deviceMapper); err != nil {
+			t.Fatal(err)
+		}
+		device := &Device{Name: "a"}
+		if _, _, err := deviceMapper.Upsert(device); err != nil {
+			t.Fatal(err)
+		}
+		// 数字转换为字符串主键
+		if device.Id != "1" {
+			t.Errorf("主键错误: %s", device.Id)
+		}
+		keygen.Register("device_seq", func() (interface{}, error) {
+			return nil, errors.New("序列不可用")
+		})
+		if _, _, err := deviceMapper.InsertOne(&Device{Name: "b"}); err == nil {
+			t.Error("生成失败时应该返回错误")
+		}
+		if err := vodka.InitMapper(&UnknownKeyGenMapper{}); err == nil {
+			t.Error("未注册的生成器应该返回错误")
+		}
+	})
+}
+
+const selectKeyXmlContent = `
+<mapper namespace="SelectKeyMapper">
+	<insert id="InsertBefore">
+		<selectKey keyProperty="id" order="BEFORE">select nextval('dep_seq')</selectKey>
+		insert into dep (id, name) values (#{id}, #{name})
+	</insert>
+	<insert id="InsertAfter">
+		insert into dep (name) values (#{dep.name})
+		<selectKey keyProperty="dep.id" keyColumn="id" order="AFTER">select last_insert_id() as id, 1 as other</selectKey>
+	</insert>
+</mapper>
+`
+
+func TestSelectKey(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	seq := int64(100)
+	fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		seq++
+		if normalizeSql(query) == "select nextval('dep_seq')" {
+			return []string{"nextval"}, [][]driver.Value{{[]byte(strconv.FormatInt(seq, 10))}}, nil
+		}
+		return []string{"id", "other"}, [][]driver.Value{{seq, int64(1)}}, nil
+	}
+	defer func() { fake.onQuery = nil }()
+	a := analyzer.NewAnalyzer(selectKeyXmlContent)
+	if err := a.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("BEFORE", func(t *testing.T) {
+		dep := &Dep{Name: "a"}
+		var rows int64
+		if err := a.Call("InsertBefore", map[string]interface{}{"dep": dep}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		exec := execs[len(execs)-1]
+		if normalizeSql(exec.Query) != "insert into dep (id, name) values (?, ?)" || exec.Args[0] != seq {
+			t.Errorf("插入语句错误: %s %v", exec.Query, exec.Args)
+		}
+		if dep.Id != seq {
+			t.Errorf("主键应该写回实体: %d", dep.Id)
+		}
+	})
+
+	t.Run("没有路径时只写回被展开的参数", func(t *testing.T) {
+		dep := &Dep{Name: "a"}
+		other := &Dep{Name: "other"}
+		var rows int64
+		if err := a.Call("InsertBefore", map[string]interface{}{"...dep": dep, "other": other}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if dep.Id != seq || other.Id != 0 {
+			t.Errorf("主键只应该写回被展开的参数: %d %d", dep.Id, other.Id)
+		}
+		// 多个被展开的参数都包含该属性时无法确定写回哪一个
+		execs := len(fake.Execs())
+		err := a.Call("InsertBefore", map[string]interface{}{"...a": &Dep{Name: "a"}, "...b": &Dep{Name: "b"}}, []interface{}{&rows})
+		if err == nil {
+			t.Error("写回的参数不唯一时应该返回错误")
+		}
+		if len(fake.Execs()) != execs {
+			t.Error("返回错误时不应该执行插入")
+		}
+	})
+
+	t.Run("AFTER", func(t *testing.T) {
+		dep := &Dep{Name: "b"}
+		commits := fake.Commits()
+		var rows int64
+		if err := a.Call("InsertAfter", map[string]interface{}{"dep": dep, "other": 1}, []interface{}{&rows}); err != nil {
+			t.Fatal(err)
+		}
+		if dep.Id != seq {
+			t.Errorf("主键应该写回实体: %d", dep.Id)
+		}
+		if fake.Commits() != commits+1 {
+			t.Error("插入和查询主键应该在同一个事务中")
+		}
+	})
+
+	t.Run("错误的selectKey", func(t *testing.T) {
+		bad := analyzer.NewAnalyzer(`<mapper namespace="BadSelectKey"><insert id="Bad"><selectKey order="BEFORE">select 1</selectKey>insert into dep (name) values ('a')</insert></mapper>`)
+		if err := bad.Parse(); err == nil {
+			t.Error("缺少keyProperty时应该返回错误")
+		}
+	})
+}
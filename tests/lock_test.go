@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"testing"
+	"vodka"
+	"vodka/analyzer"
+	"vodka/database"
+	mapper "vodka/mapper"
+	"vodka/plugin/page"
+)
+
+type Job struct {
+	Id     int64  `vo:"id"`
+	Status string `vo:"status"`
+}
+
+type JobMapper struct {
+	mapper.VodkaMapper[Job, int64]
+	_ struct{} `table:"job" pk:"id"`
+}
+
+const lockXmlContent = `
+<mapper namespace="JobQueueMapper">
+	<select id="ClaimJobs" lock="update skip locked">
+		select id, status from job where status = #{status} order by id limit #{limit}
+	</select>
+</mapper>
+`
+
+func TestLock(t *testing.T) {
+	defer database.SetDialect(database.GetDialect())
+	database.SetDialect(database.MySQL)
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	jobMapper := &JobMapper{}
+	if err := vodka.InitMapper(jobMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() string {
+		queries := fake.Queries()
+		return normalizeSql(queries[len(queries)-1].Query)
+	}
+
+	t.Run("SelectByIdForUpdate", func(t *testing.T) {
+		err := vodka.Transaction(func() error {
+			if _, err := jobMapper.SelectByIdForUpdate(1); err != nil {
+				return err
+			}
+			if sql := lastQuery(); sql != "select id,status from job where id = ? for update" {
+				t.Errorf("sql错误: %s", sql)
+			}
+			if _, err := jobMapper.SelectByIdForUpdate(1, database.ForShareNowait); err != nil {
+				return err
+			}
+			if sql := lastQuery(); sql != "select id,status from job where id = ? for share nowait" {
+				t.Errorf("sql错误: %s", sql)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("SelectAllForUpdate", func(t *testing.T) {
+		err := vodka.Transaction(func() error {
+			if _, err := jobMapper.SelectAllForUpdate(map[string]interface{}{"EQ_status": "pending"}, "id", 10, database.ForUpdateSkipLocked); err != nil {
+				return err
+			}
+			if sql := lastQuery(); sql != "select id,status from job where status = ? order by id limit ? for update skip locked" {
+				t.Errorf("sql错误: %s", sql)
+			}
+			if _, err := jobMapper.SelectAllForUpdate(nil, "", 0); err != nil {
+				return err
+			}
+			if sql := lastQuery(); sql != "select id,status from job for update" {
+				t.Errorf("sql错误: %s", sql)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("xml的lock属性", func(t *testing.T) {
+		a := analyzer.NewAnalyzer(lockXmlContent)
+		if err := a.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		var jobs []*Job
+		err := vodka.Transaction(func() error {
+			return a.Call("ClaimJobs", map[string]interface{}{"status": "pending", "limit": 5}, []interface{}{&jobs})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql := lastQuery(); sql != "select id, status from job where status = ? order by id limit ? for update skip locked" {
+			t.Errorf("sql错误: %s", sql)
+		}
+	})
+
+	t.Run("sqlite不追加加锁子句", func(t *testing.T) {
+		database.SetDialect(database.SQLite)
+		defer database.SetDialect(database.MySQL)
+		err := vodka.Transaction(func() error {
+			_, err := jobMapper.SelectByIdForUpdate(1, database.ForUpdateSkipLocked)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql := lastQuery(); sql != "select id,status from job where id = ?" {
+			t.Errorf("sql错误: %s", sql)
+		}
+	})
+
+	t.Run("非法的使用方式", func(t *testing.T) {
+		if _, err := jobMapper.SelectByIdForUpdate(1); err == nil {
+			t.Error("不在事务中加锁应该返回错误")
+		}
+		err := vodka.Transaction(func() error {
+			if _, err := jobMapper.SelectByIdForUpdate(1, database.Lock("update wait")); err == nil {
+				t.Error("不支持的锁应该返回错误")
+			}
+			if _, err := jobMapper.SelectByIdForUpdate(1, database.ForUpdate, database.ForShare); err == nil {
+				t.Error("指定多个锁应该返回错误")
+			}
+			pg := page.Page[Job]{PageNum: 1, PageSize: 10}
+			var pageErr error
+			page.DoPage(&pg, func() {
+				_, pageErr = jobMapper.SelectAllForUpdate(nil, "", 0)
+			})
+			if pageErr == nil {
+				t.Error("加锁的查询分页应该返回错误")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := analyzer.NewAnalyzer(`<mapper namespace="BadLock"><update id="Bad" lock="update">update job set status = 'done'</update></mapper>`)
+		if err := a.Parse(); err == nil {
+			t.Error("update使用lock属性应该返回错误")
+		}
+	})
+}
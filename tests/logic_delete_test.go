@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Post struct {
+	Id      int64  `vo:"id"`
+	Title   string `vo:"title"`
+	Deleted int64  `vo:"deleted,logic_delete"`
+}
+
+type PostMapper struct {
+	mapper.VodkaMapper[Post, int64]
+	_ struct{} `table:"post" pk:"id"`
+}
+
+type Comment struct {
+	Id        int64      `vo:"id"`
+	Content   string     `vo:"content"`
+	DeletedAt *time.Time `vo:"deleted_at,logic_delete"`
+}
+
+type CommentMapper struct {
+	mapper.VodkaMapper[Comment, int64]
+	_ struct{} `table:"comment" pk:"id"`
+}
+
+type Flag struct {
+	Id     int64  `vo:"id"`
+	Status string `vo:"status,logic_delete,deleted_value='D',normal_value='N'"`
+}
+
+type FlagMapper struct {
+	mapper.VodkaMapper[Flag, int64]
+	_ struct{} `table:"flag" pk:"id"`
+}
+
+// time.Time无法表示未删除的NULL
+type BadDeletedAt struct {
+	Id        int64     `vo:"id"`
+	DeletedAt time.Time `vo:"deleted_at,logic_delete"`
+}
+
+type BadDeletedAtMapper struct {
+	mapper.VodkaMapper[BadDeletedAt, int64]
+	_ struct{} `table:"bad_deleted_at" pk:"id"`
+}
+
+func TestLogicDelete(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	postMapper := &PostMapper{}
+	commentMapper := &CommentMapper{}
+	flagMapper := &FlagMapper{}
+	for _, m := range []interface{}{postMapper, commentMapper, flagMapper} {
+		if err := vodka.InitMapper(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastQuery := func() string {
+		queries := fake.Queries()
+		return normalizeSql(queries[len(queries)-1].Query)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+
+	t.Run("删除改为更新", func(t *testing.T) {
+		if _, err := postMapper.DeleteById(1); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update post set deleted = 1 where id = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := postMapper.DeleteByIds([]int64{1, 2}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update post set deleted = 1 where id in (?,?) and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := postMapper.DeleteByCondition(&Post{Title: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update post set deleted = 1 where title = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 逻辑删除的过滤条件不算作按条件删除的条件
+		if _, err := postMapper.DeleteByCondition(&Post{}); err == nil {
+			t.Error("没有条件时应该返回错误")
+		}
+	})
+
+	t.Run("查询和更新附加过滤条件", func(t *testing.T) {
+		if _, err := postMapper.SelectById(1); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select id,title,deleted from post where id = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := postMapper.CountAll(&Post{}); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select count(*) from post where deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 逻辑删除列不会被UpdateById修改
+		if _, err := postMapper.UpdateById(&Post{Id: 1, Title: "t"}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update post set title = ? where id = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := postMapper.UpdateFieldsById(&Post{Id: 1}, "deleted"); err == nil {
+			t.Error("逻辑删除列不能通过UpdateFieldsById更新")
+		}
+	})
+
+	t.Run("时间类型和自定义值", func(t *testing.T) {
+		if _, err := commentMapper.DeleteById(1); err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if query := normalizeSql(exec.Query); query != "update comment set deleted_at = ? where id = ? and deleted_at is null" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, ok := exec.Args[0].(time.Time); !ok {
+			t.Errorf("删除时间错误: %v", exec.Args[0])
+		}
+		if _, err := flagMapper.SelectByIds([]int64{1}); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select id,status from flag where id in (?) and status = 'N'" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("Unscoped", func(t *testing.T) {
+		vodka.Unscoped(func() {
+			if _, err := postMapper.SelectById(1); err != nil {
+				t.Fatal(err)
+			}
+			if query := lastQuery(); query != "select id,title,deleted from post where id = ?" {
+				t.Errorf("sql错误: %s", query)
+			}
+			if _, err := postMapper.DeleteById(1); err != nil {
+				t.Fatal(err)
+			}
+			if query := normalizeSql(lastExec().Query); query != "delete from post where id = ?" {
+				t.Errorf("sql错误: %s", query)
+			}
+			if _, err := vodka.Query[Post]().Where(vodka.Eq("id", 1)).Delete(); err != nil {
+				t.Fatal(err)
+			}
+			if query := normalizeSql(lastExec().Query); query != "delete from post where id = ?" {
+				t.Errorf("sql错误: %s", query)
+			}
+		})
+		if mapper.IsUnscoped() {
+			t.Error("Unscoped结束后应该恢复")
+		}
+	})
+
+	t.Run("插入时写入未删除的值", func(t *testing.T) {
+		// 实体中的值被忽略，插入的数据总是未删除的
+		if _, _, err := postMapper.InsertOne(&Post{Title: "a", Deleted: 1}); err != nil {
+			t.Fatal(err)
+		}
+		insert := lastExec()
+		if query := normalizeSql(insert.Query); query != "insert into post (id,title,deleted) values (DEFAULT,?,0)" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 插入的数据可以被附加了过滤条件的查询查到
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "title", "deleted"}, [][]driver.Value{{int64(1), insert.Args[0], int64(0)}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		post, err := postMapper.SelectById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select id,title,deleted from post where id = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if post == nil || post.Title != "a" || post.Deleted != 0 {
+			t.Errorf("查询结果错误: %+v", post)
+		}
+		fake.onQuery = nil
+		if _, _, err := commentMapper.InsertBatch([]*Comment{{Content: "a"}, {Content: "b"}}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "insert into comment (id,content,deleted_at) values (DEFAULT,?,NULL),(DEFAULT,?,NULL)" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, _, err := flagMapper.InsertOne(&Flag{Id: 1, Status: "D"}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "insert into flag (id,status) values (?,'N')" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("时间类型的逻辑删除列必须是指针", func(t *testing.T) {
+		if err := vodka.InitMapper(&BadDeletedAtMapper{}); err == nil {
+			t.Error("应该返回错误")
+		}
+	})
+
+	t.Run("查询构造器", func(t *testing.T) {
+		if _, err := vodka.Query[Post]().Where(vodka.Or(vodka.Eq("id", 1), vodka.Eq("id", 2))).Select(); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select id,title,deleted from post where (id = ? or id = ?) and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := vodka.Query[Post]().Count(); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select count(*) from post where deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := vodka.Query[Post]().Where(vodka.Eq("id", 1)).Delete(); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update post set deleted = 1 where id = ? and deleted = 0" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := vodka.Query[Post]().Where(vodka.Eq("id", 1)).Update(map[string]interface{}{"deleted": 0}); err == nil {
+			t.Error("逻辑删除列不能通过Update更新")
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type MapConditionDepMapper struct {
+	mapper.VodkaMapper[Dep, int64]
+	_ struct{} `table:"dep" pk:"id"`
+}
+
+func TestMapCondition(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	depMapper := &MapConditionDepMapper{}
+	if err := vodka.InitMapper(depMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() fakeCall {
+		queries := fake.Queries()
+		return queries[len(queries)-1]
+	}
+
+	cases := []struct {
+		name      string
+		condition map[string]interface{}
+		sql       string
+		args      []driver.Value
+	}{
+		{"between", map[string]interface{}{"BETWEEN_id": []int64{1, 10}}, "select count(*) from dep where id between ? and ?", []driver.Value{int64(1), int64(10)}},
+		{"not between", map[string]interface{}{"NOT_BETWEEN_id": [2]int64{1, 10}}, "select count(*) from dep where id not between ? and ?", []driver.Value{int64(1), int64(10)}},
+		{"is null", map[string]interface{}{"IS_NULL_descr": true, "IS_NOT_NULL_name": true}, "select count(*) from dep where name is not null and descr is null", []driver.Value{}},
+		{"is null为false时不生效", map[string]interface{}{"IS_NULL_descr": false}, "select count(*) from dep", []driver.Value{}},
+		{"like转义", map[string]interface{}{"LIKE_name": `50%_a\`}, "select count(*) from dep where name like ?", []driver.Value{`%50\%\_a\\%`}},
+		{"like left/right", map[string]interface{}{"LIKE_LEFT_name": "a", "LIKE_RIGHT_descr": "b"}, "select count(*) from dep where name like ? and descr like ?", []driver.Value{"%a", "b%"}},
+		{"not like", map[string]interface{}{"NOT_LIKE_name": "a"}, "select count(*) from dep where name not like ?", []driver.Value{"%a%"}},
+		{"or分组", map[string]interface{}{
+			"EQ_descr": "d",
+			"OR": []map[string]interface{}{
+				{"EQ_name": "a", "GT_id": 1},
+				{},
+				{"IN_id": []int64{5, 6}},
+			},
+		}, "select count(*) from dep where descr = ? and ((id > ? and name = ?) or (id in (?,?)))", []driver.Value{"d", int64(1), "a", int64(5), int64(6)}},
+		{"or分组跳过空的map", map[string]interface{}{
+			"OR": []map[string]interface{}{{}, {"EQ_name": "a"}, {}},
+		}, "select count(*) from dep where ((name = ?))", []driver.Value{"a"}},
+		{"or分组只有空的map", map[string]interface{}{
+			"OR": []map[string]interface{}{{}, {}},
+		}, "select count(*) from dep", []driver.Value{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := depMapper.CountAllByMap(c.condition); err != nil {
+				t.Fatal(err)
+			}
+			query := lastQuery()
+			if normalizeSql(query.Query) != c.sql {
+				t.Errorf("sql错误:\n%s\n%s", normalizeSql(query.Query), c.sql)
+			}
+			if len(query.Args) != 0 || len(c.args) != 0 {
+				if !reflect.DeepEqual(query.Args, c.args) {
+					t.Errorf("参数错误: %v %v", query.Args, c.args)
+				}
+			}
+		})
+	}
+
+	t.Run("between参数错误", func(t *testing.T) {
+		if _, err := depMapper.CountAllByMap(map[string]interface{}{"BETWEEN_id": []int64{1}}); err == nil {
+			t.Error("区间不是两个元素时应该返回错误")
+		}
+	})
+
+	t.Run("or分组只有空的map时不能按条件删除", func(t *testing.T) {
+		if _, err := depMapper.DeleteByConditionMap(map[string]interface{}{"OR": []map[string]interface{}{{}}}); err == nil {
+			t.Error("没有条件时应该返回错误")
+		}
+	})
+
+	t.Run("UpdateByConditionMap使用condition中的条件", func(t *testing.T) {
+		_, err := depMapper.UpdateByConditionMap(
+			map[string]interface{}{"IN_id": []int64{1, 2}, "OR": []map[string]interface{}{{"IS_NULL_descr": true}, {"LIKE_RIGHT_descr": "x"}}},
+			map[string]interface{}{"name": "new"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		sql := "update dep set name = ? where id in (?,?) and ((descr is null) or (descr like ?))"
+		if normalizeSql(execs[len(execs)-1].Query) != sql {
+			t.Errorf("sql错误:\n%s\n%s", normalizeSql(execs[len(execs)-1].Query), sql)
+		}
+	})
+}
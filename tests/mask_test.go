@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type maskRoleKey struct{}
+
+type Contact struct {
+	Id    int64   `vo:"id"`
+	Phone string  `vo:"phone"`
+	Email *string `vo:"email"`
+	Name  string  `vo:"name"`
+}
+
+// 脱敏在DTO上声明，实体不会被脱敏，不会把脱敏的值写回数据库
+type ContactView struct {
+	Id    int64   `vo:"id"`
+	Phone string  `vo:"phone" mask:"phone"`
+	Email *string `vo:"email" mask:"email"`
+	Name  string  `vo:"name" mask:"custom=contact_name"`
+}
+
+type ContactMapper struct {
+	mapper.VodkaMapper[Contact, int64]
+	_          struct{}                             `table:"contact" pk:"id"`
+	SelectView func(id int64) (*ContactView, error) `params:"id" sql:"select id,phone,email,name from contact where id = #{id}"`
+}
+
+type ContactSummary struct {
+	Id    int64  `vo:"id"`
+	Phone string `vo:"phone" mask:"phone"`
+}
+
+type BadMaskSummary struct {
+	Id int64 `vo:"id" mask:"phone"`
+}
+
+type LaterMaskSummary struct {
+	Id   int64  `vo:"id"`
+	Name string `vo:"name" mask:"custom=contact_later"`
+}
+
+// 实体不能声明mask
+type MaskedEntity struct {
+	Id    int64  `vo:"id"`
+	Phone string `vo:"phone" mask:"phone"`
+}
+
+type MaskedEntityMapper struct {
+	mapper.VodkaMapper[MaskedEntity, int64]
+	_ struct{} `table:"masked_entity" pk:"id"`
+}
+
+func TestMask(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	vodka.RegisterMask("contact_name", func(value string) string {
+		runes := []rune(value)
+		if len(runes) == 0 {
+			return value
+		}
+		return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	})
+	// 管理员看到原值，其余角色的email以外的列都脱敏，email只对访客脱敏
+	vodka.SetMaskDecider(func(ctx context.Context, column string) bool {
+		role, _ := ctx.Value(maskRoleKey{}).(string)
+		if role == "admin" {
+			return false
+		}
+		return column != "email" || role == "guest"
+	})
+	defer vodka.SetMaskDecider(nil)
+	contactMapper := &ContactMapper{}
+	if err := vodka.InitMapper(contactMapper); err != nil {
+		t.Fatal(err)
+	}
+	fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"id", "phone", "email", "name"}, [][]driver.Value{{int64(1), "13812341234", "alice@example.com", "张小三"}}, nil
+	}
+	defer func() { fake.onQuery = nil }()
+	withRole := func(role string, fn func()) {
+		vodka.WithContext(context.WithValue(context.Background(), maskRoleKey{}, role), fn)
+	}
+
+	t.Run("按角色脱敏", func(t *testing.T) {
+		withRole("guest", func() {
+			contact, err := contactMapper.SelectView(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contact.Phone != "138****1234" || *contact.Email != "a****@example.com" || contact.Name != "张**" {
+				t.Errorf("脱敏错误: %+v %s", contact, *contact.Email)
+			}
+		})
+		withRole("staff", func() {
+			contacts, err := vodka.SelectAllAs[ContactView](&contactMapper.VodkaMapper, nil, "", 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contacts[0].Phone != "138****1234" || *contacts[0].Email != "alice@example.com" {
+				t.Errorf("脱敏错误: %+v %s", contacts[0], *contacts[0].Email)
+			}
+		})
+		withRole("admin", func() {
+			contact, err := contactMapper.SelectView(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contact.Phone != "13812341234" || contact.Name != "张小三" {
+				t.Errorf("管理员不应该脱敏: %+v", contact)
+			}
+		})
+	})
+
+	t.Run("实体不脱敏，写回时不会覆盖原值", func(t *testing.T) {
+		withRole("guest", func() {
+			contact, err := contactMapper.SelectById(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contacts, err := vodka.Query[Contact]().Where(vodka.Eq("id", 1)).Select()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contact.Phone != "13812341234" || contacts[0].Phone != "13812341234" {
+				t.Errorf("实体不应该脱敏: %+v %+v", contact, contacts[0])
+			}
+			if _, err := contactMapper.UpdateById(contact); err != nil {
+				t.Fatal(err)
+			}
+			execs := fake.Execs()
+			if args := execs[len(execs)-1].Args; args[0] != "13812341234" {
+				t.Errorf("写回的值错误: %v", args)
+			}
+			summaries, err := vodka.SelectAllAs[ContactSummary](&contactMapper.VodkaMapper, nil, "", 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summaries[0].Phone != "138****1234" {
+				t.Errorf("脱敏错误: %+v", summaries[0])
+			}
+		})
+	})
+
+	t.Run("只有字符串字段和已注册的规则可以脱敏", func(t *testing.T) {
+		if err := vodka.InitMapper(&MaskedEntityMapper{}); err == nil {
+			t.Error("实体声明mask时应该返回错误")
+		}
+		withRole("guest", func() {
+			if _, err := vodka.SelectAllAs[BadMaskSummary](&contactMapper.VodkaMapper, nil, "", 0, 10); err == nil {
+				t.Error("非字符串字段应该返回错误")
+			}
+			if _, err := vodka.SelectAllAs[LaterMaskSummary](&contactMapper.VodkaMapper, nil, "", 0, 10); err == nil {
+				t.Error("没有注册的规则应该返回错误")
+			}
+			// 之后注册的规则同样生效
+			vodka.RegisterMask("contact_later", func(value string) string { return "***" })
+			summaries, err := vodka.SelectAllAs[LaterMaskSummary](&contactMapper.VodkaMapper, nil, "", 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summaries[0].Name != "***" {
+				t.Errorf("脱敏错误: %+v", summaries[0])
+			}
+		})
+	})
+}
@@ -1,10 +1,19 @@
 package tests
 
 import (
+	"net/http/httptest"
+	"reflect"
 	"testing"
 	"vodka/plugin/page"
 )
 
+type SortableUser struct {
+	Id       int64  `vo:"id"`
+	Name     string `vo:"name"`
+	Password string
+	Secret   string `vo:"-"`
+}
+
 func TestPage(t *testing.T) {
 	// plugin.NewPlugin()
 	//t.Run("test plugin", func(t *testing.T) {
@@ -19,7 +28,7 @@ func TestPage(t *testing.T) {
 		var pg page.Page[User]
 		pg.PageNum = 1
 		pg.PageSize = 10
-		pg.Sort = "id desc"
+		pg.Sort = []page.Order{{Column: "id", Desc: true}}
 		err := page.DoPage(&pg, func() {
 			userMapper.GetUsers()
 		})
@@ -40,6 +49,49 @@ func TestPage(t *testing.T) {
 		// log.Println(page.List)
 	})
 
+	t.Run("测试排序白名单", func(t *testing.T) {
+		orderBy, err := page.BuildOrderBy(page.ParseSort("age,-id"), []string{"id", "age"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if orderBy != " order by age asc,id desc" {
+			t.Errorf("排序语句错误: %s", orderBy)
+		}
+		if _, err := page.BuildOrderBy(page.ParseSort("id;drop table user"), []string{"id"}); err == nil {
+			t.Error("不在白名单中的列应该返回错误")
+		}
+		if orderBy, _ := page.BuildOrderBy(nil, []string{"id"}); orderBy != "" {
+			t.Errorf("没有排序条件时不应该生成order by: %s", orderBy)
+		}
+	})
+
+	t.Run("从请求中解析分页", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/users?page=2&size=20&sort=age,-id", nil)
+		pg, err := page.FromRequest[User](req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pg.PageNum != 2 || pg.PageSize != 20 || len(pg.Sort) != 2 || !pg.Sort[1].Desc {
+			t.Errorf("解析分页错误: %+v", pg)
+		}
+		req = httptest.NewRequest("GET", "/users?sort=password", nil)
+		if _, err := page.FromRequest[User](req); err == nil {
+			t.Error("不存在的列应该返回错误")
+		}
+	})
+
+	t.Run("没有vo标签的字段不能排序", func(t *testing.T) {
+		if columns := page.Columns(reflect.TypeOf(SortableUser{})); !reflect.DeepEqual(columns, []string{"id", "name"}) {
+			t.Errorf("排序白名单错误: %v", columns)
+		}
+		for _, sort := range []string{"Password", "Secret", "-Password"} {
+			req := httptest.NewRequest("GET", "/users?sort="+sort, nil)
+			if _, err := page.FromRequest[SortableUser](req); err == nil {
+				t.Errorf("%s 不应该可以排序", sort)
+			}
+		}
+	})
+
 	// pm := StartPage()
 	// defer EndPage()
 
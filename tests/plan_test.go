@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	analyzer "vodka/analyzer"
+	"vodka/runner"
+)
+
+const planXmlContent = `
+<mapper namespace="PlanRepo">
+    <sql id="fields">
+        id, name, age
+    </sql>
+
+    <select id="GetUsersByStruct">
+        SELECT <include refid="fields" /> FROM user
+        <where>
+            <if test="id != 0">
+                and id = #{id}
+            </if>
+            <if test="name != null && name != ''">
+                and name = #{name}
+            </if>
+            <if test="age != 0">
+                and age = #{age}
+            </if>
+        </where>
+    </select>
+
+    <select id="GetUsersInIds">
+        SELECT id, name FROM user WHERE id in (
+            <foreach collection="ids" item="id" separator=",">
+                #{id}
+            </foreach>
+        ) order by ${order}
+    </select>
+
+    <insert id="InsertUser">
+        INSERT INTO user (id, name) VALUES (#{id == 0 ? $AUTO : id}, #{name})
+    </insert>
+
+</mapper>
+`
+
+func newPlanAnalyzer(t testing.TB) *analyzer.Analyzer {
+	a := analyzer.NewAnalyzer(planXmlContent)
+	if err := a.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func normalizeSql(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+func TestPlan(t *testing.T) {
+	a := newPlanAnalyzer(t)
+
+	t.Run("渲染结构体参数", func(t *testing.T) {
+		sql, args, err := a.Functions["GetUsersByStruct"].Render(map[string]interface{}{"user": User{Id: 1, Age: 18}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if normalizeSql(sql) != "SELECT id, name, age FROM user where id = ? and age = ?" {
+			t.Errorf("sql错误: %s", normalizeSql(sql))
+		}
+		if len(args) != 2 || args[0] != int64(1) || args[1] != 18 {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("渲染foreach和${}", func(t *testing.T) {
+		sql, args, err := a.Functions["GetUsersInIds"].Render(map[string]interface{}{"ids": []int{1, 2, 3}, "order": "id desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if normalizeSql(sql) != "SELECT id, name FROM user WHERE id in ( ? , ? , ? ) order by id desc" {
+			t.Errorf("sql错误: %s", normalizeSql(sql))
+		}
+		if len(args) != 3 {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("渲染三元表达式", func(t *testing.T) {
+		sql, args, err := a.Functions["InsertUser"].Render(map[string]interface{}{"user": &User{Name: "张三"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if normalizeSql(sql) != "INSERT INTO user (id, name) VALUES (DEFAULT, ?)" {
+			t.Errorf("sql错误: %s", normalizeSql(sql))
+		}
+		if len(args) != 1 || args[0] != "张三" {
+			t.Errorf("参数错误: %v", args)
+		}
+	})
+
+	t.Run("执行计划可以重复渲染", func(t *testing.T) {
+		fn := a.Functions["GetUsersByStruct"]
+		for i := 0; i < 3; i++ {
+			_, args, err := fn.Render(map[string]interface{}{"user": User{Name: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args) != 1 {
+				t.Errorf("第%d次渲染参数错误: %v", i, args)
+			}
+		}
+	})
+
+	t.Run("循环include在解析时返回错误", func(t *testing.T) {
+		cycle := analyzer.NewAnalyzer(`<mapper namespace="Cycle">
+			<sql id="a"><include refid="b" /></sql>
+			<sql id="b"><include refid="a" /></sql>
+			<select id="Cycle">SELECT * FROM user <include refid="a" /></select>
+		</mapper>`)
+		if err := cycle.Parse(); err == nil {
+			t.Error("循环include应该返回错误")
+		}
+		if err := cycle.Call("Cycle", map[string]interface{}{}, nil); err == nil {
+			t.Error("调用编译失败的语句应该返回错误")
+		}
+	})
+
+	t.Run("ParseXml返回所有语句的编译错误", func(t *testing.T) {
+		_, err := analyzer.ParseXml("Broken", `<mapper>
+			<select id="A"><include refid="missing" /></select>
+			<select id="B" lock="forever">select 1</select>
+		</mapper>`)
+		if err == nil || !strings.Contains(err.Error(), "【A】") || !strings.Contains(err.Error(), "【B】") {
+			t.Errorf("应该返回两个语句的编译错误: %v", err)
+		}
+	})
+
+	t.Run("表达式编译错误", func(t *testing.T) {
+		if _, err := runner.CompileExpression("a == 1 ? 2"); err == nil {
+			t.Error("缺少冒号的三元表达式应该返回错误")
+		}
+	})
+}
+
+func BenchmarkRenderGetUsersByStruct(b *testing.B) {
+	fn := newPlanAnalyzer(b).Functions["GetUsersByStruct"]
+	user := User{Id: 1, Name: "test", Age: 18}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := fn.Render(map[string]interface{}{"user": user}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderGetUsersByStructParallel(b *testing.B) {
+	fn := newPlanAnalyzer(b).Functions["GetUsersByStruct"]
+	user := &User{Id: 1, Name: "test", Age: 18}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := fn.Render(map[string]interface{}{"user": user}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEvaluateCompiledExpression(b *testing.B) {
+	expr, err := runner.CompileExpression("EQ_name != 0 && EQ_name != '' && EQ_name != null")
+	if err != nil {
+		b.Fatal(err)
+	}
+	params := map[string]interface{}{"EQ_name": "name"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr.Evaluate(params)
+	}
+}
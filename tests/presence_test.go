@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+// 指针字段为nil时表示没有值，非nil时即使是零值也会作为条件或更新
+type Profile struct {
+	Id     int64   `vo:"id"`
+	Name   *string `vo:"name"`
+	Age    *int64  `vo:"age"`
+	Active *bool   `vo:"active"`
+	Remark string  `vo:"remark"`
+}
+
+type ProfileMapper struct {
+	mapper.VodkaMapper[Profile, int64]
+	_ struct{} `table:"profile" pk:"id"`
+}
+
+func TestFieldPresence(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	profileMapper := &ProfileMapper{}
+	if err := vodka.InitMapper(profileMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+	zero := int64(0)
+	inactive := false
+	empty := ""
+
+	t.Run("指针字段的零值参与更新", func(t *testing.T) {
+		if _, err := profileMapper.UpdateSelectiveById(&Profile{Id: 1, Age: &zero, Active: &inactive}); err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if normalizeSql(exec.Query) != "update profile set age = ?,active = ? where id = ?" {
+			t.Errorf("sql错误: %s", exec.Query)
+		}
+		if !reflect.DeepEqual(exec.Args, []driver.Value{int64(0), false, int64(1)}) {
+			t.Errorf("参数错误: %v", exec.Args)
+		}
+	})
+
+	t.Run("指针字段的零值作为查询条件", func(t *testing.T) {
+		if _, err := profileMapper.CountAll(&Profile{Name: &empty, Age: &zero}); err != nil {
+			t.Fatal(err)
+		}
+		queries := fake.Queries()
+		query := queries[len(queries)-1]
+		if normalizeSql(query.Query) != "select count(*) from profile where name = ? and age = ?" {
+			t.Errorf("sql错误: %s", query.Query)
+		}
+		if !reflect.DeepEqual(query.Args, []driver.Value{"", int64(0)}) {
+			t.Errorf("参数错误: %v", query.Args)
+		}
+	})
+
+	t.Run("UpdateFieldsById", func(t *testing.T) {
+		if _, err := profileMapper.UpdateFieldsById(&Profile{Id: 2, Age: &zero, Remark: ""}, "age", "remark"); err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if normalizeSql(exec.Query) != "update profile set age = ?,remark = ? where id = ?" {
+			t.Errorf("sql错误: %s", exec.Query)
+		}
+		// nil指针更新为NULL
+		if _, err := profileMapper.UpdateFieldsById(&Profile{Id: 2}, "name"); err != nil {
+			t.Fatal(err)
+		}
+		exec = lastExec()
+		if normalizeSql(exec.Query) != "update profile set name = ? where id = ?" || exec.Args[0] != nil {
+			t.Errorf("sql错误: %s %v", exec.Query, exec.Args)
+		}
+	})
+
+	t.Run("UpdateFieldsById校验列", func(t *testing.T) {
+		count := len(fake.Execs())
+		if _, err := profileMapper.UpdateFieldsById(&Profile{Id: 2}); err == nil {
+			t.Error("没有指定列时应该返回错误")
+		}
+		if _, err := profileMapper.UpdateFieldsById(&Profile{Id: 2}, "password"); err == nil {
+			t.Error("不存在的列应该返回错误")
+		}
+		if _, err := profileMapper.UpdateFieldsById(&Profile{Id: 2}, "id"); err == nil {
+			t.Error("主键不能更新")
+		}
+		if len(fake.Execs()) != count {
+			t.Error("校验失败时不应该执行sql")
+		}
+	})
+
+	t.Run("UpdateByConditionMap更新为NULL", func(t *testing.T) {
+		_, err := profileMapper.UpdateByConditionMap(
+			map[string]interface{}{"EQ_id": 3},
+			map[string]interface{}{"name": nil, "age": 0},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if normalizeSql(exec.Query) != "update profile set name = ?,age = ? where id = ?" {
+			t.Errorf("sql错误: %s", exec.Query)
+		}
+		if !reflect.DeepEqual(exec.Args, []driver.Value{nil, int64(0), int64(3)}) {
+			t.Errorf("参数错误: %v", exec.Args)
+		}
+	})
+
+	t.Run("查询结果映射到指针字段", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name", "age", "active", "remark"}, [][]driver.Value{{int64(1), nil, int64(0), true, nil}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		profile, err := profileMapper.SelectById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Name != nil || profile.Age == nil || *profile.Age != 0 || profile.Active == nil || !*profile.Active || profile.Remark != "" {
+			t.Errorf("结果错误: %+v", profile)
+		}
+	})
+}
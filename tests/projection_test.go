@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Card struct {
+	Id       int64  `vo:"id"`
+	Nickname string `vo:"nickname"`
+	Bio      string `vo:"bio"`
+	Online   bool   `vo:"-"`
+	Visits   int64
+}
+
+type CardMapper struct {
+	mapper.VodkaMapper[Card, int64]
+	_ struct{} `table:"card" pk:"id"`
+}
+
+type CardSummary struct {
+	Id       int64  `vo:"id"`
+	Nickname string `vo:"nickname"`
+	Label    string
+}
+
+type CardSecret struct {
+	Id       int64  `vo:"id"`
+	Password string `vo:"password"`
+}
+
+func TestProjection(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	cardMapper := &CardMapper{}
+	if err := vodka.InitMapper(cardMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() fakeCall {
+		queries := fake.Queries()
+		return queries[len(queries)-1]
+	}
+
+	t.Run("明确列出实体中的列", func(t *testing.T) {
+		if _, err := cardMapper.SelectById(1); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select id,nickname,bio from card where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := cardMapper.SelectAllByMap(map[string]interface{}{"EQ_nickname": "a"}, "", 0, 10); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select id,nickname,bio from card where nickname = ? limit ?,?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := vodka.Query[Card]().Where(vodka.Eq("id", 1)).One(); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select id,nickname,bio from card where id = ? limit ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("只查询DTO中声明的列", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "nickname"}, [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		summaries, err := vodka.SelectAllAs[CardSummary](&cardMapper.VodkaMapper, map[string]interface{}{"GTE_id": 1}, "id desc", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summaries) != 2 || *summaries[1] != (CardSummary{Id: 2, Nickname: "b"}) {
+			t.Errorf("查询结果错误: %+v", summaries)
+		}
+		call := lastQuery()
+		if query := normalizeSql(call.Query); query != "select id,nickname from card where id >= ? order by id desc limit ?,?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if !reflect.DeepEqual(call.Args, []driver.Value{int64(1), int64(0), int64(10)}) {
+			t.Errorf("参数错误: %v", call.Args)
+		}
+	})
+
+	t.Run("非法的列", func(t *testing.T) {
+		if _, err := vodka.SelectAllAs[CardSecret](&cardMapper.VodkaMapper, nil, "", 0, 10); err == nil {
+			t.Error("实体中不存在的列应该返回错误")
+		}
+		if _, err := cardMapper.SelectColumnsByMap([]string{"id", "bio from card; --"}, nil, "", 0, 10); err == nil {
+			t.Error("非法的列应该返回错误")
+		}
+	})
+}
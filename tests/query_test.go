@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+	"vodka/plugin/page"
+	"vodka/query"
+)
+
+type Member struct {
+	Id   int64  `vo:"id"`
+	Name string `vo:"name"`
+	Age  int64  `vo:"age"`
+}
+
+type MemberMapper struct {
+	mapper.VodkaMapper[Member, int64]
+	_ struct{} `table:"member" pk:"id"`
+}
+
+type UnmappedEntity struct {
+	Id int64 `vo:"id"`
+}
+
+func TestQueryBuilder(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	if err := vodka.InitMapper(&MemberMapper{}); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() fakeCall {
+		queries := fake.Queries()
+		return queries[len(queries)-1]
+	}
+
+	t.Run("Select", func(t *testing.T) {
+		fake.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"id", "name", "age"}, [][]driver.Value{{int64(1), "张三", int64(18)}}, nil
+		}
+		defer func() { fake.onQuery = nil }()
+		members, err := vodka.Query[Member]().
+			Where(vodka.Eq("age", 18)).
+			And(vodka.Like("name", "张"), vodka.Or(vodka.In("id", []int64{1, 2}), vodka.IsNull("name"))).
+			OrderBy("id", vodka.Desc).
+			Limit(10).
+			Offset(20).
+			Select()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 1 || members[0].Name != "张三" {
+			t.Errorf("结果错误: %v", members)
+		}
+		query := lastQuery()
+		sql := "select id,name,age from member where age = ? and name like ? and (id in (?,?) or name is null) order by id desc limit ? offset ?"
+		if normalizeSql(query.Query) != sql {
+			t.Errorf("sql错误:\n%s\n%s", query.Query, sql)
+		}
+		args := []driver.Value{int64(18), "%张%", int64(1), int64(2), int64(10), int64(20)}
+		if !reflect.DeepEqual(query.Args, args) {
+			t.Errorf("参数错误: %v", query.Args)
+		}
+	})
+
+	t.Run("Count不受分页影响", func(t *testing.T) {
+		var pg page.Page[Member]
+		pg.PageNum = 1
+		pg.PageSize = 10
+		err := page.DoPage(&pg, func() {
+			if _, err := vodka.Query[Member]().Where(vodka.Between("age", 18, 30)).Count(); err != nil {
+				t.Error(err)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastQuery().Query); query != "select count(*) from member where age between ? and ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("Update和Delete", func(t *testing.T) {
+		rows, err := vodka.Query[Member]().Where(vodka.Gt("age", 60)).Update(map[string]interface{}{"name": "老人", "age": 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows != 1 {
+			t.Errorf("影响行数错误: %d", rows)
+		}
+		if _, err := vodka.Query[Member]().Where(vodka.In("id", []int64{})).Delete(); err != nil {
+			t.Fatal(err)
+		}
+		execs := fake.Execs()
+		if normalizeSql(execs[len(execs)-2].Query) != "update member set age = ?,name = ? where age > ?" {
+			t.Errorf("sql错误: %s", execs[len(execs)-2].Query)
+		}
+		if normalizeSql(execs[len(execs)-1].Query) != "delete from member where 1 = 0" {
+			t.Errorf("sql错误: %s", execs[len(execs)-1].Query)
+		}
+	})
+
+	t.Run("恒成立的条件不能Update和Delete", func(t *testing.T) {
+		cases := map[string]query.Condition{
+			"空的And":      vodka.And(),
+			"空集合的NotIn":  vodka.NotIn("id", []int64{}),
+			"Or中有空的And":  vodka.Or(vodka.And()),
+			"Or中有恒成立的条件": vodka.Or(vodka.Eq("id", 1), vodka.NotIn("id", []int64{})),
+		}
+		execs := len(fake.Execs())
+		for name, condition := range cases {
+			if _, err := vodka.Query[Member]().Where(condition).Delete(); err == nil {
+				t.Errorf("%s: 删除应该返回错误", name)
+			}
+			if _, err := vodka.Query[Member]().Where(condition).Update(map[string]interface{}{"name": "x"}); err == nil {
+				t.Errorf("%s: 更新应该返回错误", name)
+			}
+		}
+		if len(fake.Execs()) != execs {
+			t.Error("被拒绝的语句不应该执行")
+		}
+	})
+
+	t.Run("校验", func(t *testing.T) {
+		if _, err := vodka.Query[Member]().Where(vodka.Eq("password", 1)).Select(); err == nil {
+			t.Error("不存在的列应该返回错误")
+		}
+		if _, err := vodka.Query[Member]().OrderBy("id;drop table member", vodka.Asc).Select(); err == nil {
+			t.Error("不存在的排序列应该返回错误")
+		}
+		if _, err := vodka.Query[Member]().Delete(); err == nil {
+			t.Error("没有条件的删除应该返回错误")
+		}
+		if _, err := vodka.Query[Member]().Update(map[string]interface{}{"name": "x"}); err == nil {
+			t.Error("没有条件的更新应该返回错误")
+		}
+		if _, err := vodka.Query[UnmappedEntity]().Select(); err == nil {
+			t.Error("没有注册的实体应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"vodka"
+	"vodka/analyzer"
+	"vodka/database"
+)
+
+func TestStmtCache(t *testing.T) {
+	t.Run("未开启缓存时每次都prepare", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		for i := 0; i < 3; i++ {
+			if _, err := database.QueryMap(db, "select * from user where id = ?", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if fake.Prepares() != 3 {
+			t.Errorf("prepare次数错误: %d", fake.Prepares())
+		}
+		if _, ok := database.GetStmtCacheStats(db); ok {
+			t.Error("未开启缓存时不应该有统计信息")
+		}
+	})
+
+	t.Run("开启缓存后复用语句", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.EnableStmtCache(db, 2)
+		defer database.DisableStmtCache(db)
+		for i := 0; i < 3; i++ {
+			if _, err := database.QueryMap(db, "select * from user where id = ?", i); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.ExecuteInt64(db, "update user set age = ? where id = ?", []interface{}{i, 1}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if fake.Prepares() != 2 {
+			t.Errorf("prepare次数错误: %d", fake.Prepares())
+		}
+		stats, _ := database.GetStmtCacheStats(db)
+		if stats.Hits != 4 || stats.Misses != 2 || stats.Size != 2 {
+			t.Errorf("统计信息错误: %+v", stats)
+		}
+	})
+
+	t.Run("超过容量时淘汰最久未使用的语句", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.EnableStmtCache(db, 2)
+		defer database.DisableStmtCache(db)
+		queries := []string{"select 1", "select 2", "select 1", "select 3", "select 2"}
+		for _, query := range queries {
+			if _, err := database.QueryMap(db, query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stats, _ := database.GetStmtCacheStats(db)
+		// select 3 淘汰 select 2，之后的 select 2 淘汰 select 1
+		if stats.Evictions != 2 || stats.Size != 2 || fake.Prepares() != 4 {
+			t.Errorf("统计信息错误: %+v, prepare次数: %d", stats, fake.Prepares())
+		}
+	})
+
+	t.Run("事务内复用语句", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		database.EnableStmtCache(db, 2)
+		defer database.DisableStmtCache(db)
+		err := vodka.Transaction(func() error {
+			tx := analyzer.CurrentTx()
+			if tx == nil {
+				return errors.New("没有开启事务")
+			}
+			for i := 0; i < 3; i++ {
+				if err := database.ExecuteInt64(tx, "insert into user(name) values(?)", []interface{}{"test"}, nil); err != nil {
+					return err
+				}
+			}
+			if stats := tx.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+				t.Errorf("事务内统计信息错误: %+v", stats)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 数据源上prepare一次，事务的连接上再prepare一次，之后复用
+		if fake.Prepares() != 2 || len(fake.Execs()) != 3 || fake.Commits() != 1 {
+			t.Errorf("prepare次数: %d, 执行次数: %d, 提交次数: %d", fake.Prepares(), len(fake.Execs()), fake.Commits())
+		}
+	})
+
+	t.Run("未开启缓存时事务内不缓存语句", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		database.EnableStmtCache(db, 2)
+		database.DisableStmtCache(db)
+		err := vodka.Transaction(func() error {
+			tx := analyzer.CurrentTx()
+			for i := 0; i < 3; i++ {
+				if err := database.ExecuteInt64(tx, "insert into user(name) values(?)", []interface{}{"test"}, nil); err != nil {
+					return err
+				}
+			}
+			if stats := tx.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+				t.Errorf("未开启缓存时不应该使用事务内缓存: %+v", stats)
+			}
+			// batch执行器显式复用事务内的语句
+			return tx.CacheStmts(func() error {
+				for i := 0; i < 2; i++ {
+					if err := database.ExecuteInt64(tx, "update user set name = ?", []interface{}{"test"}, nil); err != nil {
+						return err
+					}
+				}
+				if stats := tx.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+					t.Errorf("事务内统计信息错误: %+v", stats)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// fake驱动没有实现Execer，直接执行时由database/sql逐条prepare
+		if fake.Prepares() != 4 || len(fake.Execs()) != 5 {
+			t.Errorf("prepare次数: %d, 执行次数: %d", fake.Prepares(), len(fake.Execs()))
+		}
+	})
+
+	t.Run("事务出错时回滚", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		err := vodka.Transaction(func() error {
+			return errors.New("出错了")
+		})
+		if err == nil || fake.Rollbacks() != 1 || fake.Commits() != 0 {
+			t.Errorf("事务应该回滚, err: %v", err)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Event struct {
+	Id   int64  `vo:"id"`
+	Name string `vo:"name"`
+}
+
+func (Event) TableName() string {
+	return "event"
+}
+
+type EventMapper struct {
+	mapper.VodkaMapper[Event, int64]
+	_ struct{} `pk:"id" schema:"audit"`
+}
+
+type BadTableMapper struct {
+	mapper.VodkaMapper[Dep, int64]
+	_ struct{} `table:"dep;drop" pk:"id"`
+}
+
+func TestTableName(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	eventMapper := &EventMapper{}
+	if err := vodka.InitMapper(eventMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastQuery := func() string {
+		queries := fake.Queries()
+		return normalizeSql(queries[len(queries)-1].Query)
+	}
+	lastExec := func() string {
+		execs := fake.Execs()
+		return normalizeSql(execs[len(execs)-1].Query)
+	}
+
+	t.Run("TableName方法和schema", func(t *testing.T) {
+		if _, err := eventMapper.SelectById(1); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastQuery(); query != "select id,name from audit.event where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("WithTable副本", func(t *testing.T) {
+		monthly := eventMapper.WithTable("audit.event_202410")
+		if _, _, err := monthly.InsertOne(&Event{Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastExec(); query != "insert into audit.event_202410 (id,name) values (DEFAULT,?)" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 可变参数的方法
+		if _, err := monthly.UpdateFieldsById(&Event{Id: 1, Name: "b"}, "name"); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastExec(); query != "update audit.event_202410 set name = ? where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 原mapper不受影响
+		if _, err := eventMapper.DeleteById(1); err != nil {
+			t.Fatal(err)
+		}
+		if query := lastExec(); query != "delete from audit.event where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("WithTable和ctx", func(t *testing.T) {
+		vodka.WithTable("audit.event", "audit.event_202411", func() {
+			if _, err := eventMapper.CountAll(&Event{}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := vodka.Query[Event]().Where(vodka.Eq("id", 1)).Count(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		queries := fake.Queries()
+		for _, call := range queries[len(queries)-2:] {
+			if query := normalizeSql(call.Query); query != "select count(*) from audit.event_202411 where id = ?" && query != "select count(*) from audit.event_202411" {
+				t.Errorf("sql错误: %s", query)
+			}
+		}
+		ctx := vodka.ContextWithTable(context.Background(), "audit.event", "audit.event_202412")
+		vodka.WithContext(ctx, func() {
+			if _, err := eventMapper.SelectById(1); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if query := lastQuery(); query != "select id,name from audit.event_202412 where id = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("非法的表名", func(t *testing.T) {
+		if _, err := eventMapper.WithTable("event; drop table event").SelectById(1); err == nil {
+			t.Error("非法的表名应该返回错误")
+		}
+		if err := vodka.InitMapper(&BadTableMapper{}); err == nil {
+			t.Error("非法的表名应该返回错误")
+		}
+	})
+}
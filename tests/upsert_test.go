@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Setting struct {
+	Id    int64  `vo:"id"`
+	Key   string `vo:"key"`
+	Value string `vo:"value"`
+}
+
+type MySQLSettingMapper struct {
+	mapper.VodkaMapper[Setting, int64]
+	_ struct{} `table:"setting" pk:"id" unique:"key"`
+}
+
+type PgSettingMapper struct {
+	mapper.VodkaMapper[Setting, int64]
+	_ struct{} `table:"setting" pk:"id" unique:"key"`
+}
+
+func TestUpsert(t *testing.T) {
+	defer database.SetDialect(database.GetDialect())
+
+	t.Run("mysql", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		database.SetDialect(database.MySQL)
+		settingMapper := &MySQLSettingMapper{}
+		if err := vodka.InitMapper(settingMapper); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := settingMapper.Upsert(&Setting{Key: "theme", Value: "dark"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := settingMapper.UpsertBatch([]*Setting{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := settingMapper.InsertIgnore(&Setting{Key: "theme", Value: "light"}); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"insert into setting (id,key,value) values (DEFAULT,?,?) on duplicate key update value = values(value)",
+			"insert into setting (id,key,value) values (DEFAULT,?,?),(DEFAULT,?,?) on duplicate key update value = values(value)",
+			"insert ignore into setting (id,key,value) values (DEFAULT,?,?)",
+		}
+		execs := fake.Execs()
+		for i, sql := range expected {
+			if normalizeSql(execs[i].Query) != sql {
+				t.Errorf("sql错误:\n%s\n%s", normalizeSql(execs[i].Query), sql)
+			}
+		}
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db, fake := openFakeDB(t)
+		database.SetDB(db)
+		database.SetDialect(database.PostgreSQL)
+		settingMapper := &PgSettingMapper{}
+		if err := vodka.InitMapper(settingMapper); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := settingMapper.Upsert(&Setting{Key: "theme", Value: "dark"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := settingMapper.InsertIgnore(&Setting{Key: "theme", Value: "light"}); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"insert into setting (id,key,value) values (DEFAULT,?,?) on conflict (key) do update set value = excluded.value",
+			"insert into setting (id,key,value) values (DEFAULT,?,?) on conflict do nothing",
+		}
+		execs := fake.Execs()
+		for i, sql := range expected {
+			if normalizeSql(execs[i].Query) != sql {
+				t.Errorf("sql错误:\n%s\n%s", normalizeSql(execs[i].Query), sql)
+			}
+		}
+	})
+
+	t.Run("没有需要更新的列", func(t *testing.T) {
+		if clause := database.MySQL.UpsertClause([]string{"id"}, nil); clause != " on duplicate key update id = id" {
+			t.Errorf("mysql子句错误: %s", clause)
+		}
+		if clause := database.SQLite.UpsertClause([]string{"a", "b"}, nil); clause != " on conflict (a,b) do nothing" {
+			t.Errorf("sqlite子句错误: %s", clause)
+		}
+	})
+}
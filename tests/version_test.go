@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"vodka"
+	"vodka/database"
+	mapper "vodka/mapper"
+)
+
+type Account struct {
+	Id      int64  `vo:"id"`
+	Owner   string `vo:"owner"`
+	Version int64  `vo:"version,version"`
+}
+
+type AccountMapper struct {
+	mapper.VodkaMapper[Account, int64]
+	_ struct{} `table:"account" pk:"id"`
+}
+
+func TestVersionLock(t *testing.T) {
+	db, fake := openFakeDB(t)
+	database.SetDB(db)
+	accountMapper := &AccountMapper{}
+	if err := vodka.InitMapper(accountMapper); err != nil {
+		t.Fatal(err)
+	}
+	lastExec := func() fakeCall {
+		execs := fake.Execs()
+		return execs[len(execs)-1]
+	}
+	// 指定的版本号更新时不影响任何行
+	staleVersion := func(version int64) {
+		fake.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+			if len(args) > 0 && args[len(args)-1] == version {
+				return fakeResult{rowsAffected: 0}, nil
+			}
+			return fakeResult{rowsAffected: 1}, nil
+		}
+	}
+	defer func() { fake.onExec = nil }()
+
+	t.Run("UpdateById", func(t *testing.T) {
+		account := &Account{Id: 1, Owner: "a", Version: 3}
+		if _, err := accountMapper.UpdateById(account); err != nil {
+			t.Fatal(err)
+		}
+		exec := lastExec()
+		if normalizeSql(exec.Query) != "update account set version = version + 1,owner = ? where id = ? and version = ?" {
+			t.Errorf("sql错误: %s", exec.Query)
+		}
+		if !reflect.DeepEqual(exec.Args, []driver.Value{"a", int64(1), int64(3)}) {
+			t.Errorf("参数错误: %v", exec.Args)
+		}
+		if account.Version != 4 {
+			t.Errorf("版本号应该加1: %d", account.Version)
+		}
+	})
+
+	t.Run("UpdateSelectiveById冲突", func(t *testing.T) {
+		staleVersion(5)
+		defer func() { fake.onExec = nil }()
+		account := &Account{Id: 1, Version: 5}
+		_, err := accountMapper.UpdateSelectiveById(account)
+		if !errors.Is(err, vodka.ErrStaleObject) {
+			t.Fatalf("应该返回乐观锁冲突: %v", err)
+		}
+		var staleErr *mapper.StaleObjectError
+		if !errors.As(err, &staleErr) || staleErr.Table != "account" || staleErr.Version != int64(5) {
+			t.Errorf("错误信息不正确: %v", err)
+		}
+		if account.Version != 5 {
+			t.Errorf("冲突时版本号不应该改变: %d", account.Version)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update account set version = version + 1 where id = ? and version = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+	})
+
+	t.Run("按条件更新时版本号加1", func(t *testing.T) {
+		if _, err := accountMapper.UpdateByConditionMap(map[string]interface{}{"EQ_owner": "a"}, map[string]interface{}{"owner": "b"}); err != nil {
+			t.Fatal(err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update account set version = version + 1,owner = ? where owner = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		if _, err := accountMapper.UpdateFieldsById(&Account{Id: 1}, "version"); err == nil {
+			t.Error("版本号列不能通过UpdateFieldsById更新")
+		}
+	})
+
+	t.Run("查询构造器按版本号更新", func(t *testing.T) {
+		staleVersion(7)
+		defer func() { fake.onExec = nil }()
+		_, err := vodka.Query[Account]().Where(vodka.Eq("id", 1), vodka.Eq("version", int64(7))).Update(map[string]interface{}{"owner": "c"})
+		var staleErr *mapper.StaleObjectError
+		if !errors.As(err, &staleErr) || staleErr.Table != "account" || staleErr.Version != int64(7) {
+			t.Fatalf("应该返回乐观锁冲突: %v", err)
+		}
+		if query := normalizeSql(lastExec().Query); query != "update account set version = version + 1,owner = ? where id = ? and version = ?" {
+			t.Errorf("sql错误: %s", query)
+		}
+		// 条件中没有版本号时不检查
+		if _, err := vodka.Query[Account]().Where(vodka.Eq("owner", "c")).Update(map[string]interface{}{"owner": "d"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// 将value赋值给field，用于把生成或查询到的主键写回实体
+// 指针字段会分配新的值，数字之间直接转换，字符串和数字之间按十进制转换
+func AssignValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := AssignValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	source := reflect.ValueOf(value)
+	if source.Type().AssignableTo(field.Type()) {
+		field.Set(source)
+		return nil
+	}
+	if b, ok := value.([]byte); ok {
+		value, source = string(b), reflect.ValueOf(string(b))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(fmt.Sprint(value))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := value.(string); ok {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			field.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s, ok := value.(string); ok {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			field.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if s, ok := value.(string); ok {
+			n, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return err
+			}
+			field.SetFloat(n)
+			return nil
+		}
+	}
+	if source.Kind() != reflect.String && source.Type().ConvertibleTo(field.Type()) {
+		field.Set(source.Convert(field.Type()))
+		return nil
+	}
+	return fmt.Errorf("%T 不能赋值给 %s", value, field.Type())
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"strings"
+)
+
+// vo标签，格式为 列名,选项,选项=值，如 vo:"deleted,logic_delete,deleted_value=1"
+type VoTag struct {
+	Name    string
+	Options map[string]string
+}
+
+func ParseVoTag(tag string) VoTag {
+	parts := strings.Split(tag, ",")
+	voTag := VoTag{Name: strings.TrimSpace(parts[0])}
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if voTag.Options == nil {
+			voTag.Options = make(map[string]string)
+		}
+		key, value, _ := strings.Cut(part, "=")
+		voTag.Options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return voTag
+}
+
+// 是否声明了选项
+func (t VoTag) Has(option string) bool {
+	_, ok := t.Options[option]
+	return ok
+}
+
+// 选项的值，没有声明时返回defaultValue
+func (t VoTag) Get(option string, defaultValue string) string {
+	if value, ok := t.Options[option]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// vo标签中的列名
+func VoName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return strings.TrimSpace(name)
+}
+
+// vo:"-" 表示忽略该字段，不对应任何列
+func VoIgnored(tag string) bool {
+	return VoName(tag) == "-"
+}
+
+// vo:"phone,encrypt" 表示加密的列，vo:"phone,encrypt=deterministic" 使用确定性加密，可以等值查询
+func VoEncrypt(tag string) (encrypted bool, deterministic bool) {
+	voTag := ParseVoTag(tag)
+	return voTag.Has("encrypt"), voTag.Get("encrypt", "") == "deterministic"
+}
@@ -1,7 +1,12 @@
 package vodka
 
 import (
+	"context"
+	"vodka/analyzer"
+	"vodka/encrypt"
 	"vodka/mapper"
+	"vodka/mask"
+	"vodka/query"
 )
 
 func ScanMapper(dir string) error {
@@ -11,3 +16,96 @@ func ScanMapper(dir string) error {
 func InitMapper(source interface{}) error {
 	return mapper.InitMapper(source)
 }
+
+// 在事务中执行fn，fn返回错误或者panic时回滚，否则提交
+func Transaction(fn func() error) error {
+	return analyzer.Transaction(fn)
+}
+
+// 在fn中忽略逻辑删除，查询包含已删除的行，删除方法物理删除
+func Unscoped(fn func()) {
+	mapper.Unscoped(fn)
+}
+
+// 乐观锁冲突，按版本号更新时没有影响任何行返回的错误满足 errors.Is(err, vodka.ErrStaleObject)
+var ErrStaleObject = mapper.ErrStaleObject
+
+// 写入前校验失败，check标签中的规则未通过时返回，可以使用 errors.As 获取所有未通过的字段
+type ValidationError = mapper.ValidationError
+
+// 在fn中执行的语句使用ctx，自动填充处理器可以从ctx中获取当前用户等信息
+func WithContext(ctx context.Context, fn func()) {
+	mapper.WithContext(ctx, fn)
+}
+
+// 注册自动填充的处理器，详见mapper.FillHandler
+func RegisterFillHandler(handler mapper.FillHandler) {
+	mapper.RegisterFillHandler(handler)
+}
+
+// 在fn中执行的语句，表table替换为actual，用于按月分表等场景
+func WithTable(table, actual string, fn func()) {
+	mapper.WithTable(table, actual, fn)
+}
+
+// 返回一个新的ctx，在WithContext(ctx, fn)中执行的语句，表table替换为actual
+func ContextWithTable(ctx context.Context, table, actual string) context.Context {
+	return mapper.ContextWithTable(ctx, table, actual)
+}
+
+// 只查询DTO中声明的列，结果按vo标签映射为DTO，详见mapper.SelectAllAs
+func SelectAllAs[DTO any, T any, ID any](m *mapper.VodkaMapper[T, ID], params map[string]interface{}, order string, offset int64, limit int64) ([]*DTO, error) {
+	return mapper.SelectAllAs[DTO](m, params, order, offset, limit)
+}
+
+// 分组聚合查询，结果按vo标签映射为DTO，详见mapper.GroupByAs
+func GroupByAs[DTO any, T any, ID any](m *mapper.VodkaMapper[T, ID], columns []string, aggregates []string, params map[string]interface{}) ([]*DTO, error) {
+	return mapper.GroupByAs[DTO](m, columns, aggregates, params)
+}
+
+// 注册列加密的密钥，vo标签中声明了encrypt的列写入时加密，查询时解密
+func RegisterKeyProvider(provider encrypt.KeyProvider) {
+	encrypt.RegisterKeyProvider(provider)
+}
+
+// 设置查询结果是否脱敏的判断，一般从ctx中读取调用者的角色，没有设置时不脱敏
+func SetMaskDecider(decider mask.Decider) {
+	mask.SetDecider(decider)
+}
+
+// 注册脱敏函数，在字段上使用 mask:"custom=name" 引用
+func RegisterMask(name string, fn mask.Func) {
+	mask.Register(name, fn)
+}
+
+// 创建实体T的查询构造器，T所在的VodkaMapper必须已经InitMapper
+func Query[T any]() *query.Builder[T] {
+	return query.New[T]()
+}
+
+// 查询构造器的条件，详见query包
+var (
+	Eq         = query.Eq
+	Ne         = query.Ne
+	Gt         = query.Gt
+	Ge         = query.Ge
+	Lt         = query.Lt
+	Le         = query.Le
+	Like       = query.Like
+	NotLike    = query.NotLike
+	LikeLeft   = query.LikeLeft
+	LikeRight  = query.LikeRight
+	In         = query.In
+	NotIn      = query.NotIn
+	Between    = query.Between
+	NotBetween = query.NotBetween
+	IsNull     = query.IsNull
+	IsNotNull  = query.IsNotNull
+	And        = query.And
+	Or         = query.Or
+)
+
+const (
+	Asc  = query.Asc
+	Desc = query.Desc
+)